@@ -18,7 +18,7 @@ This will add file/s to the config file for ccoco to generate.
 `,
 	Args: cobra.MinimumNArgs(1),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		instance, err := ccoco.New()
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
 		if err != nil {
 			return err
 		}
@@ -26,9 +26,10 @@ This will add file/s to the config file for ccoco to generate.
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := app.AddToFiles(args); err != nil {
+		result, err := app.AddToFiles(args)
+		if err != nil {
 			return err
 		}
-		return nil
+		return printResult(result, nil)
 	},
 }
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	cli.AddCommand(cloneCmd)
+}
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone <from>",
+	Short: "Clone the configs of a branch into the current branch",
+	Long: `Clones the configs of a branch into the current branch.
+This will overwrite the configs of the current branch with the files stored for the given branch.`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := app.CloneConfigs(cmd.Context(), args[0]); err != nil {
+			return err
+		}
+		return printResult(actionResult{Command: "clone", From: args[0]}, nil)
+	},
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	cli.AddCommand(copyCmd)
+}
+
+var copyCmd = &cobra.Command{
+	Use:     "copy <from> <to> [file1 file2 ...]",
+	Aliases: []string{"cp"},
+	Short:   "Copy configs between branches",
+	Long: `Copies the configs of a branch to another branch.
+This will overwrite the configs of the target branch with the files stored for the source branch.
+All stored files are copied when no file is given.`,
+	Args: cobra.MinimumNArgs(2),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := app.CopyConfigs(cmd.Context(), args[0], args[1], ccoco.CopyOptions{
+			Files: args[2:],
+		}); err != nil {
+			return err
+		}
+		return printResult(actionResult{Command: "copy", From: args[0], To: args[1]}, nil)
+	},
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	diffCmd.Flags().StringVarP(&diffBranch, "branch", "b", "", "Compare with the configs of this branch instead of the current one")
+	cli.AddCommand(diffCmd)
+}
+
+var diffCmd = &cobra.Command{
+	Use:     "diff [file1 file2 ...]",
+	Aliases: []string{"d"},
+	Short:   "Show differences between configs and working files",
+	Long: `Shows the differences between the configs of a branch and your working files.
+This will compare against the configs of the current branch unless --branch is given.
+Encrypted configs are decrypted before comparing.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		diffs, err := app.Diff(cmd.Context(), ccoco.DiffOptions{
+			Branch: diffBranch,
+			Files:  args,
+		})
+		if err != nil {
+			return err
+		}
+
+		return printResult(diffs, func() error {
+			for _, diff := range diffs {
+				switch {
+				case !diff.Stored:
+					fmt.Printf("%s: not stored\n", diff.File)
+				case !diff.Exists:
+					fmt.Printf("%s: missing from the working tree\n", diff.File)
+				case diff.Binary:
+					fmt.Printf("%s: binary files differ\n", diff.File)
+				default:
+					fmt.Print(diff.Patch)
+				}
+			}
+			return nil
+		})
+	},
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "Repair the problems that can be repaired")
+	doctorCmd.Flags().BoolVar(&doctorJSON, "json", false, "Print the report as JSON, same as --output json")
+	cli.AddCommand(doctorCmd)
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the ccoco setup for problems",
+	Long: `Checks the ccoco setup of the repository for problems.
+This will check the ccoco directories, the config file, the .gitignore, the git hooks,
+the stored files and their permissions, and look for configs of renamed or deleted branches.
+With --fix, the problems that can be repaired are repaired.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			// The config file itself is checked, so a broken one mustn't stop the doctor
+			logger.Warn("Failed to load the config", "error", err)
+			instance, err = ccoco.OpenUnloaded(cmd.Context(), ".", ccoco.WithLogger(logger))
+			if err != nil {
+				return err
+			}
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		report, err := app.Doctor(cmd.Context(), ccoco.DoctorOptions{
+			Fix: doctorFix,
+		})
+		if err != nil {
+			return err
+		}
+
+		if doctorJSON {
+			outputFormat = outputJSON
+		}
+		if err := printResult(report, func() error {
+			for _, check := range report.Checks {
+				hint := ""
+				if check.Fixable && check.Status != ccoco.CheckFixed && !doctorFix {
+					hint = " (fixable with --fix)"
+				}
+				fmt.Printf("[%s] %s: %s%s\n", check.Status, check.Name, check.Message, hint)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if !report.Healthy {
+			return reportedError{fmt.Errorf("found %d problem(s)", len(report.Problems()))}
+		}
+		return nil
+	},
+}
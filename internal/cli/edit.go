@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	editCmd.Flags().StringVarP(&editBranch, "branch", "b", "", "Edit the configs of this branch instead of the current one")
+	cli.AddCommand(editCmd)
+}
+
+var editCmd = &cobra.Command{
+	Use:     "edit <file>",
+	Aliases: []string{"e"},
+	Short:   "Edit a stored config",
+	Long: `Edits the stored copy of a file in $VISUAL or $EDITOR.
+This will decrypt the file to a private temporary directory and store it again, encrypted if enabled, when the editor exits.
+Your working file is not changed until the configs are applied.`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		branch := editBranch
+		if branch == "" {
+			var err error
+			branch, err = app.ConfigBranch()
+			if err != nil {
+				return err
+			}
+		}
+
+		data, err := app.ReadStored(branch, args[0])
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		// Keep the decrypted copy in a directory only the current user can read
+		dir, err := os.MkdirTemp("", "ccoco-edit-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, filepath.Base(args[0]))
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return err
+		}
+
+		if err := runEditor(path); err != nil {
+			return err
+		}
+
+		edited, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(data, edited) {
+			logger.Info("Stored file is unchanged", "file", args[0], "branch", branch)
+			return printResult(actionResult{Command: "edit", To: branch, Path: args[0], Skipped: "unchanged"}, nil)
+		}
+		if err := app.WriteStored(branch, args[0], edited); err != nil {
+			return err
+		}
+		logger.Info("Saved file", "file", args[0], "branch", branch)
+		return printResult(actionResult{Command: "edit", To: branch, Path: args[0]}, nil)
+	},
+}
+
+// runEditor opens path in the user's editor and waits for it to exit
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	fields := strings.Fields(editor)
+	editorCmd := exec.Command(fields[0], append(fields[1:], path)...)
+	editorCmd.Stdin = os.Stdin
+	editorCmd.Stdout = os.Stdout
+	editorCmd.Stderr = os.Stderr
+	return editorCmd.Run()
+}
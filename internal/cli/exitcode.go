@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+// Exit codes of the CLI, documented in the README
+const (
+	exitOK             = 0
+	exitError          = 1
+	exitUsage          = 2
+	exitNotInitialized = 3
+	exitNoConfig       = 4
+	exitMalformedStore = 5
+	exitHookConflict   = 6
+	exitDirtyFile      = 7
+	exitPlaintextStore = 8
+	exitRenameFailed   = 9
+	exitSeedFailed     = 10
+)
+
+// usageError is returned for invalid arguments and flags
+type usageError struct {
+	error
+}
+
+func (e usageError) Unwrap() error {
+	return e.error
+}
+
+// exitCode maps err to the exit code of the CLI
+func exitCode(err error) int {
+	var usage usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.Is(err, ccoco.ErrNotInitialized):
+		return exitNotInitialized
+	// Seeding and renames fail on the errors below, the step that failed matters more
+	case errors.Is(err, ccoco.ErrRenameFailed):
+		return exitRenameFailed
+	case errors.Is(err, ccoco.ErrSeedFailed):
+		return exitSeedFailed
+	case errors.Is(err, ccoco.ErrNoConfig):
+		return exitNoConfig
+	case errors.Is(err, ccoco.ErrMalformedStore):
+		return exitMalformedStore
+	case errors.Is(err, ccoco.ErrHookConflict):
+		return exitHookConflict
+	case errors.Is(err, ccoco.ErrDirtyFile):
+		return exitDirtyFile
+	case errors.Is(err, ccoco.ErrPlaintextStore):
+		return exitPlaintextStore
+	default:
+		return exitError
+	}
+}
+
+// wrapUsageErrors marks the argument and flag errors of cmd and its subcommands as usage errors
+func wrapUsageErrors(cmd *cobra.Command) {
+	if args := cmd.Args; args != nil {
+		cmd.Args = func(cmd *cobra.Command, values []string) error {
+			if err := args(cmd, values); err != nil {
+				return usageError{err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		wrapUsageErrors(sub)
+	}
+}
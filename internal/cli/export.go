@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	exportCmd.Flags().StringVarP(&exportFile, "file", "o", "ccoco-bundle.tar.gz", "Path of the bundle")
+	exportCmd.Flags().BoolVarP(&encryptBundle, "encrypt", "e", false, "Encrypt the bundle with a passphrase")
+	cli.AddCommand(exportCmd)
+}
+
+// exportResult is the metadata of an exported bundle along with its path
+type exportResult struct {
+	Bundle string `json:"bundle"`
+	*ccoco.BundleMetadata
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export [branch1 branch2 ...]",
+	Short: "Export configs to a bundle",
+	Long: `Exports the configs of the given branches, or of every branch, to a tar.gz bundle.
+This will record the target path, mode and branch of every file so the bundle can be imported into any project.
+The passphrase of an encrypted bundle is read from CCOCO_PASSPHRASE or prompted for.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		passphrase := ""
+		if encryptBundle {
+			var err error
+			passphrase, err = readPassphrase(true)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Write next to the target so a failed export doesn't leave a truncated bundle
+		f, err := os.CreateTemp(filepath.Dir(exportFile), ".ccoco-bundle-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+
+		metadata, err := app.Export(cmd.Context(), f, ccoco.ExportOptions{
+			Branches:   args,
+			Passphrase: passphrase,
+		})
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if err := os.Chmod(f.Name(), 0600); err != nil {
+			return err
+		}
+		if err := os.Rename(f.Name(), exportFile); err != nil {
+			return err
+		}
+
+		logger.Info("Exported configs", "files", len(metadata.Files), "bundle", exportFile)
+		return printResult(exportResult{Bundle: exportFile, BundleMetadata: metadata}, nil)
+	},
+}
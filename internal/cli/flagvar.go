@@ -1,6 +1,30 @@
 package cli
 
 // Centralized file for flag variables
+var outputFormat string
+var quiet bool
+var verbose bool
+var logFormat string
 var skipGitHookExecute bool
 var addToGitIgnore bool
 var injectCcocoToGitHooks bool
+var gitHooks []string
+var forceGitHook bool
+var forceKeygen bool
+var diffBranch string
+var editBranch string
+var mergeStrategy string
+var allowPlaintext bool
+var exportFile string
+var encryptBundle bool
+var importReplace bool
+var importMerge bool
+var importBranches []string
+var pruneDryRun bool
+var pruneOlderThan string
+var pruneRemotes bool
+var pruneArchive string
+var generateRemotes string
+var generateBranches []string
+var doctorFix bool
+var doctorJSON bool
@@ -1,14 +1,22 @@
 package cli
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
 	"github.com/xarunoba/ccoco/pkg/ccoco"
 )
 
 func init() {
+	generateCmd.Flags().StringVarP(&generateRemotes, "remotes", "r", "", "Also generate configs for the remote-tracking branches of a remote, or of every remote when none is given")
+	generateCmd.Flags().Lookup("remotes").NoOptDefVal = allRemotes
+	generateCmd.Flags().StringSliceVarP(&generateBranches, "branches", "b", nil, "Only generate configs for branches matching these globs, e.g. feature/*")
 	cli.AddCommand(generateCmd)
 }
 
+// allRemotes is the value of --remotes when it is given without a remote
+const allRemotes = "*"
+
 var generateCmd = &cobra.Command{
 	Use:     "generate",
 	Aliases: []string{"gen"},
@@ -16,9 +24,9 @@ var generateCmd = &cobra.Command{
 	Long: `Generates per-branch config files for the files specified in ccoco.config.json.
 This will populate the branch configs folder based on the existing branches.
 	`,
-	Args: cobra.NoArgs,
+	Args: cobra.MaximumNArgs(1),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		instance, err := ccoco.New()
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
 		if err != nil {
 			return err
 		}
@@ -26,9 +34,25 @@ This will populate the branch configs folder based on the existing branches.
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := app.GenerateConfigs(); err != nil {
+		opts := ccoco.GenerateOptions{
+			Remotes:  generateRemotes != "",
+			Branches: generateBranches,
+		}
+		if generateRemotes != "" && generateRemotes != allRemotes {
+			opts.Remote = generateRemotes
+		}
+		// Allow "--remotes origin" as well as "--remotes=origin"
+		if len(args) > 0 {
+			if generateRemotes != allRemotes {
+				return usageError{fmt.Errorf("unexpected argument %s", args[0])}
+			}
+			opts.Remote = args[0]
+		}
+
+		result, err := app.GenerateConfigs(cmd.Context(), opts)
+		if err != nil {
 			return err
 		}
-		return nil
+		return printResult(result, nil)
 	},
 }
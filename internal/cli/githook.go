@@ -8,6 +8,8 @@ import (
 func init() {
 	cli.AddCommand(githookCmd)
 	githookCmd.Flags().BoolVarP(&skipGitHookExecute, "skip", "s", false, "Skip git hook execution")
+	githookCmd.Flags().StringSliceVar(&gitHooks, "hooks", []string{ccoco.HookPostCheckout}, "Git hooks to inject ccoco to (post-checkout, pre-commit)")
+	githookCmd.Flags().BoolVarP(&forceGitHook, "force", "f", false, "Replace git hooks that were not written by ccoco")
 }
 
 var githookCmd = &cobra.Command{
@@ -16,9 +18,11 @@ var githookCmd = &cobra.Command{
 	Short:   "Inject ccoco to git hooks",
 	Long: `Injects ccoco to git hooks without depending on a git hook manager.
 This will add a post-checkout hook to automatically change config on checkout.
+With --hooks pre-commit, a pre-commit hook is added to block commits containing ccoco configs.
 	`,
+	Args: cobra.NoArgs,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		instance, err := ccoco.New()
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
 		if err != nil {
 			return err
 		}
@@ -26,11 +30,13 @@ This will add a post-checkout hook to automatically change config on checkout.
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := app.AddToGitHooks(ccoco.AddToGitHooksOptions{
+		if err := app.AddToGitHooks(cmd.Context(), ccoco.AddToGitHooksOptions{
 			SkipExecution: skipGitHookExecute,
+			Hooks:         gitHooks,
+			Force:         forceGitHook,
 		}); err != nil {
 			return err
 		}
-		return nil
+		return printResult(actionResult{Command: "githook"}, nil)
 	},
 }
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	cli.AddCommand(guardCmd)
+}
+
+var guardCmd = &cobra.Command{
+	Use:   "guard",
+	Short: "Block commits containing ccoco configs",
+	Long: `Checks the staged files for content stored in ccoco configs.
+This will fail when a managed file is staged with the content of a branch config.
+Set SKIP_CCOCO=1 or SKIP_CCOCO_GUARD=1 to commit anyway.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if name := ccoco.GuardSkipped(); name != "" {
+			logger.Info(name + " is set to 1, skipping ccoco guard")
+			return printResult(actionResult{Command: "guard", Skipped: name + " is set to 1"}, nil)
+		}
+		if err := app.Guard(cmd.Context()); err != nil {
+			return err
+		}
+		return printResult(actionResult{Command: "guard"}, nil)
+	},
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	importCmd.Flags().BoolVar(&importMerge, "merge", false, "Add the files of the bundle to the stored files (default)")
+	importCmd.Flags().BoolVar(&importReplace, "replace", false, "Remove the stored files of every imported branch first")
+	importCmd.Flags().StringSliceVarP(&importBranches, "branches", "b", nil, "Only import these branches")
+	importCmd.MarkFlagsMutuallyExclusive("merge", "replace")
+	cli.AddCommand(importCmd)
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <bundle>",
+	Short: "Import configs from a bundle",
+	Long: `Imports the configs of a bundle created with ccoco export.
+This will add the files of the bundle to your configs, or replace the configs of every imported branch with --replace.
+The passphrase of an encrypted bundle is read from CCOCO_PASSPHRASE or prompted for.`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		opts := ccoco.ImportOptions{
+			Mode:     ccoco.ImportMerge,
+			Branches: importBranches,
+		}
+		if importReplace {
+			opts.Mode = ccoco.ImportReplace
+		}
+		if ccoco.IsEncryptedBundle(data) {
+			opts.Passphrase, err = readPassphrase(false)
+			if err != nil {
+				return err
+			}
+		}
+
+		metadata, err := app.Import(cmd.Context(), bytes.NewReader(data), opts)
+		if err != nil {
+			return err
+		}
+		return printResult(metadata, nil)
+	},
+}
@@ -17,8 +17,9 @@ var initCmd = &cobra.Command{
 	Aliases: []string{"i"},
 	Short:   "Initialize ccoco",
 	Long:    `Initialize ccoco in the current git repository.`,
+	Args:    cobra.NoArgs,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		instance, err := ccoco.New()
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
 		if err != nil {
 			return err
 		}
@@ -26,7 +27,7 @@ var initCmd = &cobra.Command{
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := app.Init(ccoco.InitOptions{
+		if err := app.Init(cmd.Context(), ccoco.InitOptions{
 			AddToGitIgnore: addToGitIgnore,
 			AddToGitHooks:  injectCcocoToGitHooks,
 			AddToGitHooksOptions: ccoco.AddToGitHooksOptions{
@@ -35,6 +36,6 @@ var initCmd = &cobra.Command{
 		}); err != nil {
 			return err
 		}
-		return nil
+		return printResult(actionResult{Command: "init"}, nil)
 	},
 }
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	keygenCmd.Flags().BoolVarP(&forceKeygen, "force", "f", false, "Overwrite an existing key. Files encrypted with it can no longer be read")
+	cli.AddCommand(keygenCmd)
+}
+
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate an encryption key",
+	Long: `Generates a key used to encrypt stored configs.
+This will write the key to your user config directory, or to the path in CCOCO_KEY_FILE.
+Share the key with your team through a password manager, never through the repository.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := ccoco.DefaultKeyFile()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err == nil && !forceKeygen {
+			return fmt.Errorf("%s already exists, use --force to replace it or ccoco rekey to rotate it", path)
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		key, err := ccoco.GenerateKey()
+		if err != nil {
+			return err
+		}
+		if err := ccoco.WriteKey(path, key); err != nil {
+			return err
+		}
+		logger.Info("Wrote a new key", "path", path)
+		return printResult(actionResult{Command: "keygen", Path: path}, nil)
+	},
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// Formats of --log-format
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logger writes the logs of the CLI and of ccoco to stderr
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// newLogger creates the logger configured by --quiet, --verbose and --log-format
+func newLogger() (*slog.Logger, error) {
+	level := slog.LevelInfo
+	if quiet {
+		level = slog.LevelError
+	} else if verbose {
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch logFormat {
+	case logFormatText:
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case logFormatJSON:
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("unsupported log format %s, use %s or %s", logFormat, logFormatText, logFormatJSON)
+	}
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Formats of --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// checkOutputFormat validates --output
+func checkOutputFormat() error {
+	if outputFormat != outputText && outputFormat != outputJSON {
+		return fmt.Errorf("unsupported output format %s, use %s or %s", outputFormat, outputText, outputJSON)
+	}
+	return nil
+}
+
+// printResult prints result as JSON to stdout with --output json and calls text
+// otherwise. text may be nil for commands whose text output is their log.
+func printResult(result any, text func() error) error {
+	if outputFormat == outputJSON {
+		return printJSON(result)
+	}
+	if text == nil {
+		return nil
+	}
+	return text()
+}
+
+// printJSON prints v as indented JSON to stdout
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(data))
+	return err
+}
+
+// errorResult is printed instead of the result of a failed command with --output json
+type errorResult struct {
+	Error string `json:"error"`
+	// Code is the exit code of the command
+	Code int `json:"code"`
+}
+
+// actionResult is printed with --output json by commands without a result of their own
+type actionResult struct {
+	Command string `json:"command"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+	Remote  string `json:"remote,omitempty"`
+	Path    string `json:"path,omitempty"`
+	// Skipped explains why the command did nothing
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// reportedError is returned by commands whose output already describes the
+// failure, so it isn't printed again with --output json
+type reportedError struct {
+	error
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	pruneCmd.Flags().BoolVarP(&pruneDryRun, "dry-run", "n", false, "Only list the configs that would be pruned")
+	pruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "Only prune configs not modified within this age, e.g. 30d or 12h")
+	pruneCmd.Flags().BoolVarP(&pruneRemotes, "remotes", "r", false, "Keep the configs of branches that still exist on a remote")
+	pruneCmd.Flags().StringVarP(&pruneArchive, "archive", "a", "", "Export the pruned configs to this bundle first")
+	cli.AddCommand(pruneCmd)
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete the configs of deleted branches",
+	Long: `Deletes the configs of branches that no longer exist.
+This will keep the configs of sub-branch roots that are still used by existing branches, and of the base profile.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		olderThan, err := parseAge(pruneOlderThan)
+		if err != nil {
+			return usageError{err}
+		}
+
+		stale, err := app.Prune(cmd.Context(), ccoco.PruneOptions{
+			DryRun:    pruneDryRun,
+			OlderThan: olderThan,
+			Remotes:   pruneRemotes,
+			Archive:   pruneArchive,
+		})
+		if err != nil {
+			return err
+		}
+		return printResult(stale, func() error {
+			if len(stale) == 0 {
+				fmt.Println("No configs to prune")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "BRANCH\tFILES\tLAST MODIFIED\tACTION")
+			for _, branch := range stale {
+				action := "prune"
+				if !branch.Pruned {
+					action = "keep (" + branch.Reason + ")"
+				} else if pruneDryRun {
+					action = "prune (dry run)"
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", branch.Branch, branch.Files, branch.ModTime.Format(time.DateTime), action)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+// parseAge parses a duration that may also be given in days, e.g. 30d
+func parseAge(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return age, nil
+}
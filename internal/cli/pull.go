@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	pullCmd.Flags().StringVarP(&mergeStrategy, "strategy", "s", "", "Resolve conflicting changes with \"ours\" or \"theirs\"")
+	cli.AddCommand(pullCmd)
+}
+
+var pullCmd = &cobra.Command{
+	Use:   "pull [remote]",
+	Short: "Pull the configs from a remote",
+	Long: `Fetches refs/ccoco/store from a remote and merges it into your configs.
+This will commit your local configs first, and fail on conflicting changes unless --strategy is given.`,
+	Args: cobra.MaximumNArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		remote := ccoco.DefaultRemote
+		if len(args) > 0 {
+			remote = args[0]
+		}
+		if err := app.Pull(cmd.Context(), ccoco.PullOptions{
+			Remote:   remote,
+			Strategy: mergeStrategy,
+		}); err != nil {
+			return err
+		}
+		return printResult(actionResult{Command: "pull", Remote: remote}, nil)
+	},
+}
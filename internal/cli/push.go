@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	pushCmd.Flags().StringVarP(&mergeStrategy, "strategy", "s", "", "Resolve conflicting changes with \"ours\" or \"theirs\"")
+	pushCmd.Flags().BoolVar(&allowPlaintext, "allow-plaintext", false, "Push a store that isn't encrypted")
+	cli.AddCommand(pushCmd)
+}
+
+var pushCmd = &cobra.Command{
+	Use:   "push [remote]",
+	Short: "Push the configs to a remote",
+	Long: `Commits the configs to refs/ccoco/store and pushes them to a remote.
+This will merge the configs pushed by others first, and fail on conflicting changes unless --strategy is given.
+Stores that aren't encrypted are refused unless --allow-plaintext is given.`,
+	Args: cobra.MaximumNArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		remote := ccoco.DefaultRemote
+		if len(args) > 0 {
+			remote = args[0]
+		}
+		if err := app.Push(cmd.Context(), ccoco.PushOptions{
+			Remote:         remote,
+			Strategy:       mergeStrategy,
+			AllowPlaintext: allowPlaintext,
+		}); err != nil {
+			return err
+		}
+		return printResult(actionResult{Command: "push", Remote: remote}, nil)
+	},
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	cli.AddCommand(rekeyCmd)
+}
+
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Re-encrypt the configs with a new key",
+	Long: `Re-encrypts every stored config with a newly generated key.
+This will replace your key file. Files that aren't encrypted yet are encrypted as well.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := app.Rekey(cmd.Context()); err != nil {
+			return err
+		}
+		return printResult(actionResult{Command: "rekey"}, nil)
+	},
+}
@@ -17,7 +17,7 @@ var removeCmd = &cobra.Command{
 This will remove file/s from the config file for ccoco to generate.`,
 	Args: cobra.MinimumNArgs(1),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		instance, err := ccoco.New()
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
 		if err != nil {
 			return err
 		}
@@ -25,9 +25,10 @@ This will remove file/s from the config file for ccoco to generate.`,
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := app.RemoveFromFiles(args); err != nil {
+		result, err := app.RemoveFromFiles(args)
+		if err != nil {
 			return err
 		}
-		return nil
+		return printResult(result, nil)
 	},
 }
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	cli.AddCommand(renameCmd)
+}
+
+var renameCmd = &cobra.Command{
+	Use:     "rename <old> <new>",
+	Aliases: []string{"mv"},
+	Short:   "Rename the configs of a branch",
+	Long: `Renames the configs of a branch, e.g. after renaming the branch itself.
+This will move every stored file of the old branch to the new one. The new branch must not have configs yet.`,
+	Args: cobra.ExactArgs(2),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := app.RenameConfigs(cmd.Context(), args[0], args[1]); err != nil {
+			return err
+		}
+		return printResult(actionResult{Command: "rename", From: args[0], To: args[1]}, nil)
+	},
+}
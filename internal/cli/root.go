@@ -1,7 +1,11 @@
 package cli
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 
 	"github.com/spf13/cobra"
@@ -16,6 +20,23 @@ var cli = &cobra.Command{
 	Short: "Change config on checkout",
 	Long: `ccoco changes your config files based on your current branch.
 Integrate with git hooks to automatically change config on checkout.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkOutputFormat(); err != nil {
+			return usageError{err}
+		}
+		var err error
+		if logger, err = newLogger(); err != nil {
+			return usageError{err}
+		}
+		// Failures are reported as part of the JSON output
+		if outputFormat == outputJSON {
+			cmd.Root().SilenceErrors = true
+			cmd.Root().SilenceUsage = true
+		}
+		return nil
+	},
+	// Unknown commands are usage errors, see wrapUsageErrors
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		err := cmd.Help()
 		if err != nil {
@@ -26,6 +47,37 @@ Integrate with git hooks to automatically change config on checkout.`,
 	Version: version.Version,
 }
 
+func init() {
+	cli.PersistentFlags().StringVar(&outputFormat, "output", outputText, "Output format, text or json")
+	cli.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only log errors")
+	cli.PersistentFlags().BoolVar(&verbose, "verbose", false, "Also log debug messages")
+	cli.PersistentFlags().StringVar(&logFormat, "log-format", logFormatText, "Log format, text or json")
+	cli.MarkFlagsMutuallyExclusive("quiet", "verbose")
+	// Only usage errors point to the help, see Execute
+	cli.SilenceUsage = true
+	cli.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return usageError{err}
+	})
+}
+
 func Execute() {
-	_ = cli.Execute()
+	wrapUsageErrors(cli)
+
+	// Interrupting cancels the running command, config files are rolled back
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if cmd, err := cli.ExecuteContextC(ctx); err != nil {
+		code := exitCode(err)
+		if code == exitUsage && outputFormat != outputJSON {
+			fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", cmd.CommandPath())
+		}
+		var reported reportedError
+		if outputFormat == outputJSON && !errors.As(err, &reported) {
+			if err := printJSON(errorResult{Error: err.Error(), Code: code}); err != nil {
+				logger.Error("Failed to print the error", "error", err)
+			}
+		}
+		os.Exit(code)
+	}
 }
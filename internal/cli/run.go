@@ -15,8 +15,9 @@ var runCmd = &cobra.Command{
 	Short:   "Run ccoco",
 	Long: `Run ccoco. 
 This will change config files based on your current branch.`,
+	Args: cobra.NoArgs,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		instance, err := ccoco.New()
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
 		if err != nil {
 			return err
 		}
@@ -24,11 +25,12 @@ This will change config files based on your current branch.`,
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := app.Run(ccoco.RunOptions{
+		result, err := app.Run(cmd.Context(), ccoco.RunOptions{
 			ForceToBranch: nil,
-		}); err != nil {
+		})
+		if err != nil {
 			return err
 		}
-		return nil
+		return printResult(result, nil)
 	},
 }
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	cli.AddCommand(saveCmd)
+}
+
+var saveCmd = &cobra.Command{
+	Use:     "save [file1 file2 ...]",
+	Aliases: []string{"s"},
+	Short:   "Save working files to the current branch",
+	Long: `Saves working files to the configs of the current branch.
+This will overwrite the stored copies with the files in your working tree, including their permissions.
+All files in ccoco.config.json are saved when no file is given.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := app.Save(cmd.Context(), ccoco.SaveOptions{
+			Files: args,
+		})
+		if err != nil {
+			return err
+		}
+		return printResult(result, nil)
+	},
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/xarunoba/ccoco/pkg/ccoco"
+)
+
+func init() {
+	cli.AddCommand(statusCmd)
+}
+
+var statusCmd = &cobra.Command{
+	Use:     "status",
+	Aliases: []string{"st"},
+	Short:   "Show what ccoco will do on the current branch",
+	Long: `Shows what ccoco will do on the current branch.
+This will list every managed file, whether the branch has a stored copy of it and which action will be taken.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		instance, err := ccoco.Open(cmd.Context(), ".", ccoco.WithLogger(logger))
+		if err != nil {
+			return err
+		}
+		app = instance
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		status, err := app.Status(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		return printResult(status, func() error {
+			fmt.Printf("On branch %s, using configs from %s\n\n", status.Branch, status.ConfigBranch)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "FILE\tSTORED\tTRACKED\tON MISSING\tACTION")
+			for _, file := range status.Files {
+				action := file.Action
+				if file.Reason != "" {
+					action += " (" + file.Reason + ")"
+				}
+				fmt.Fprintf(w, "%s\t%t\t%t\t%s\t%s\n", file.File, file.Stored, file.Tracked, file.OnMissing, action)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			for _, file := range status.Files {
+				if file.Warning != "" {
+					fmt.Printf("\nwarning: %s: %s", file.File, file.Warning)
+				}
+			}
+			fmt.Println()
+			return nil
+		})
+	},
+}
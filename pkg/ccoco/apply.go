@@ -0,0 +1,296 @@
+package ccoco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// applyOperation replaces or removes a single file in the working tree.
+// When Symlink is set the file is replaced by a symbolic link to Symlink instead of Data.
+type applyOperation struct {
+	File    string
+	Path    string
+	Data    []byte
+	Mode    os.FileMode
+	Symlink string
+	Remove  bool
+}
+
+// ApplyError is returned when a config set could not be applied. Every file
+// replaced before the failure has been rolled back unless RollbackErrors says otherwise.
+type ApplyError struct {
+	Failed         string
+	Err            error
+	Applied        []string
+	RolledBack     []string
+	RollbackErrors []error
+}
+
+func (e *ApplyError) Error() string {
+	msg := fmt.Sprintf("failed to apply %s: %v", e.Failed, e.Err)
+	if len(e.RolledBack) > 0 {
+		msg += fmt.Sprintf("; rolled back %s", strings.Join(e.RolledBack, ", "))
+	}
+	if len(e.RollbackErrors) > 0 {
+		msg += fmt.Sprintf("; rollback failed: %v", errors.Join(e.RollbackErrors...))
+	}
+	return msg
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+// appliedOperation remembers how to undo an operation
+type appliedOperation struct {
+	file        string
+	path        string
+	backup      string
+	createdDirs []string
+}
+
+// transaction applies operations so that either all of them or none of them take effect
+type transaction struct {
+	fs      billy.Filesystem
+	logger  *slog.Logger
+	applied []appliedOperation
+}
+
+// applyAll applies every operation, rolling back on the first failure or when
+// ctx is cancelled. When applied is set it is called after each operation.
+// When finalize is set it runs once every operation succeeded, and its failure
+// rolls back the operations as well.
+func applyAll(ctx context.Context, fsys billy.Filesystem, logger *slog.Logger, operations []applyOperation, applied func(applyOperation), finalize func() error) error {
+	t := &transaction{fs: fsys, logger: logger}
+	for _, operation := range operations {
+		if err := ctx.Err(); err != nil {
+			return t.fail(operation.File, err)
+		}
+		if err := t.apply(operation); err != nil {
+			return t.fail(operation.File, err)
+		}
+		if applied != nil {
+			applied(operation)
+		}
+	}
+	if finalize != nil {
+		if err := finalize(); err != nil {
+			return t.fail("index", err)
+		}
+	}
+	t.commit()
+	return nil
+}
+
+// fail rolls back the transaction and describes what happened
+func (t *transaction) fail(file string, err error) *ApplyError {
+	applyErr := &ApplyError{Failed: file, Err: err}
+	for _, applied := range t.applied {
+		applyErr.Applied = append(applyErr.Applied, applied.file)
+	}
+	applyErr.RolledBack, applyErr.RollbackErrors = t.rollback()
+	return applyErr
+}
+
+func (t *transaction) apply(operation applyOperation) error {
+	dir := filepath.Dir(operation.Path)
+	base := filepath.Base(operation.Path)
+
+	previous, err := t.fs.Lstat(operation.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if previous == nil && operation.Remove {
+		return nil
+	}
+
+	createdDirs, err := mkdirAllTracked(t.fs, dir)
+	if err != nil {
+		return err
+	}
+	applied := appliedOperation{file: operation.File, path: operation.Path, createdDirs: createdDirs}
+
+	// Write the new content next to the target so the final rename is atomic
+	temp := ""
+	if operation.Symlink != "" {
+		temp, err = symlinkTemp(t.fs, dir, base, operation.Symlink)
+		if err != nil {
+			removeDirs(t.fs, createdDirs)
+			return err
+		}
+	} else if !operation.Remove {
+		temp, err = writeTemp(t.fs, dir, base, operation.Data, operation.Mode)
+		if err != nil {
+			removeDirs(t.fs, createdDirs)
+			return err
+		}
+		if previous != nil && previous.Mode().IsRegular() {
+			if err := chownLike(t.fs, temp, previous); err != nil {
+				t.logger.Warn("Failed to preserve owner", "file", operation.File, "error", err)
+			}
+		}
+	}
+
+	// Keep the previous file around until the whole set is applied
+	if previous != nil {
+		backup, err := backupPath(t.fs, dir, base)
+		if err != nil {
+			_ = t.fs.Remove(temp)
+			return err
+		}
+		// A hard link keeps the target in place until the rename, a rename is the fallback
+		if previous.IsDir() || operation.Remove || link(t.fs, operation.Path, backup) != nil {
+			if err := t.fs.Rename(operation.Path, backup); err != nil {
+				if temp != "" {
+					_ = t.fs.Remove(temp)
+				}
+				return err
+			}
+		}
+		applied.backup = backup
+	}
+
+	if temp != "" {
+		if err := t.fs.Rename(temp, operation.Path); err != nil {
+			_ = t.fs.Remove(temp)
+			t.applied = append(t.applied, applied)
+			return err
+		}
+	}
+
+	t.applied = append(t.applied, applied)
+	return nil
+}
+
+// rollback restores every applied operation in reverse order
+func (t *transaction) rollback() ([]string, []error) {
+	rolledBack := []string{}
+	errs := []error{}
+	for i := len(t.applied) - 1; i >= 0; i-- {
+		applied := t.applied[i]
+		if applied.backup != "" {
+			if err := removeAll(t.fs, applied.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+				continue
+			}
+			if err := t.fs.Rename(applied.backup, applied.path); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		} else if err := t.fs.Remove(applied.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		removeDirs(t.fs, applied.createdDirs)
+		rolledBack = append(rolledBack, applied.file)
+	}
+	t.applied = nil
+	return rolledBack, errs
+}
+
+// commit removes the backups of every applied operation
+func (t *transaction) commit() {
+	for _, applied := range t.applied {
+		if applied.backup == "" {
+			continue
+		}
+		if err := removeAll(t.fs, applied.backup); err != nil {
+			t.logger.Warn("Failed to remove backup", "path", applied.backup, "error", err)
+		}
+	}
+	t.applied = nil
+}
+
+// writeTemp writes data to a temporary file in dir and returns its path
+func writeTemp(fsys billy.Filesystem, dir, base string, data []byte, mode os.FileMode) (string, error) {
+	f, err := fsys.TempFile(dir, "."+base+".ccoco-tmp-")
+	if err != nil {
+		return "", err
+	}
+	temp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		_ = fsys.Remove(temp)
+		return "", err
+	}
+	if err := syncFile(f); err != nil {
+		f.Close()
+		_ = fsys.Remove(temp)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = fsys.Remove(temp)
+		return "", err
+	}
+	if err := chmod(fsys, temp, mode.Perm()); err != nil {
+		_ = fsys.Remove(temp)
+		return "", err
+	}
+	return temp, nil
+}
+
+// symlinkTemp creates a temporary symbolic link to target in dir and returns its path
+func symlinkTemp(fsys billy.Filesystem, dir, base, target string) (string, error) {
+	temp, err := reservePath(fsys, dir, "."+base+".ccoco-tmp-")
+	if err != nil {
+		return "", err
+	}
+	if err := fsys.Symlink(target, temp); err != nil {
+		return "", err
+	}
+	return temp, nil
+}
+
+// backupPath reserves an unused backup path in dir
+func backupPath(fsys billy.Filesystem, dir, base string) (string, error) {
+	return reservePath(fsys, dir, "."+base+".ccoco-backup-")
+}
+
+// reservePath returns an unused path in dir starting with prefix
+func reservePath(fsys billy.Filesystem, dir, prefix string) (string, error) {
+	f, err := fsys.TempFile(dir, prefix)
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	f.Close()
+	if err := fsys.Remove(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// mkdirAllTracked creates dir and returns the directories it created, deepest first
+func mkdirAllTracked(fsys billy.Filesystem, dir string) ([]string, error) {
+	missing := []string{}
+	for current := dir; ; current = filepath.Dir(current) {
+		if _, err := fsys.Lstat(current); err == nil {
+			break
+		}
+		missing = append(missing, current)
+		if filepath.Dir(current) == current {
+			break
+		}
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	if err := fsys.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// removeDirs removes directories created by mkdirAllTracked if they are empty
+func removeDirs(fsys billy.Filesystem, dirs []string) {
+	for _, dir := range dirs {
+		_ = fsys.Remove(dir)
+	}
+}
@@ -0,0 +1,213 @@
+package ccoco
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+)
+
+// listTestFiles returns the content of every regular file of fsys by path
+func listTestFiles(t *testing.T, fsys billy.Filesystem) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := walkDir(fsys, "/", func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		data, err := readFile(fsys, path)
+		files[path] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// failingFilesystem fails to rename a new file onto failPath, but not a backup
+type failingFilesystem struct {
+	billy.Filesystem
+	failPath string
+}
+
+var errRename = errors.New("rename failed")
+
+func (f failingFilesystem) Rename(oldpath, newpath string) error {
+	if newpath == f.failPath && strings.Contains(oldpath, ".ccoco-tmp-") {
+		return errRename
+	}
+	return f.Filesystem.Rename(oldpath, newpath)
+}
+
+func TestApplyAll(t *testing.T) {
+	errFinalize := errors.New("finalize failed")
+	initial := map[string]string{
+		"/.env":         "old env",
+		"/config.json":  "old config",
+		"/stale/.npmrc": "stale",
+	}
+
+	tests := []struct {
+		name        string
+		operations  []applyOperation
+		cancel      bool
+		finalize    error
+		want        map[string]string
+		wantFailed  string
+		wantErr     error
+		wantApplied []string
+		// wantRolledBack defaults to wantApplied
+		wantRolledBack []string
+	}{
+		{
+			name: "applies every operation",
+			operations: []applyOperation{
+				{File: ".env", Path: "/.env", Data: []byte("new env"), Mode: 0600},
+				{File: "certs/dev.pem", Path: "/certs/dev.pem", Data: []byte("pem"), Mode: 0600},
+				{File: "stale/.npmrc", Path: "/stale/.npmrc", Remove: true},
+			},
+			want: map[string]string{
+				"/.env":          "new env",
+				"/config.json":   "old config",
+				"/certs/dev.pem": "pem",
+			},
+		},
+		{
+			name: "removing a missing file is a no-op",
+			operations: []applyOperation{
+				{File: "missing", Path: "/missing", Remove: true},
+			},
+			want: initial,
+		},
+		{
+			name: "rolls back on a failed operation",
+			operations: []applyOperation{
+				{File: ".env", Path: "/.env", Data: []byte("new env"), Mode: 0600},
+				{File: "certs/dev.pem", Path: "/certs/dev.pem", Data: []byte("pem"), Mode: 0600},
+				{File: "stale/.npmrc", Path: "/stale/.npmrc", Remove: true},
+				{File: "config.json", Path: "/config.json", Data: []byte("new config"), Mode: 0644},
+			},
+			want:           initial,
+			wantFailed:     "config.json",
+			wantErr:        errRename,
+			wantApplied:    []string{".env", "certs/dev.pem", "stale/.npmrc"},
+			wantRolledBack: []string{".env", "certs/dev.pem", "stale/.npmrc", "config.json"},
+		},
+		{
+			name: "rolls back on a failed finalize",
+			operations: []applyOperation{
+				{File: ".env", Path: "/.env", Data: []byte("new env"), Mode: 0600},
+				{File: "config.json", Path: "/config.json", Remove: true},
+			},
+			finalize:    errFinalize,
+			want:        initial,
+			wantFailed:  "index",
+			wantErr:     errFinalize,
+			wantApplied: []string{".env", "config.json"},
+		},
+		{
+			name: "stops when cancelled",
+			operations: []applyOperation{
+				{File: ".env", Path: "/.env", Data: []byte("new env"), Mode: 0600},
+			},
+			cancel:     true,
+			want:       initial,
+			wantFailed: ".env",
+			wantErr:    context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := billy.Filesystem(failingFilesystem{Filesystem: memfs.New(), failPath: "/config.json"})
+			for path, content := range initial {
+				if err := fsys.MkdirAll("/stale", 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := writeFile(fsys, path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			applied := []string{}
+			err := applyAll(ctx, fsys, discardLogger(), tt.operations, func(operation applyOperation) {
+				applied = append(applied, operation.File)
+			}, func() error {
+				return tt.finalize
+			})
+
+			if tt.wantFailed == "" {
+				if err != nil {
+					t.Fatalf("applyAll() error = %v", err)
+				}
+			} else {
+				var applyErr *ApplyError
+				if !errors.As(err, &applyErr) {
+					t.Fatalf("applyAll() error = %v, want an ApplyError", err)
+				}
+				if applyErr.Failed != tt.wantFailed {
+					t.Errorf("Failed = %q, want %q", applyErr.Failed, tt.wantFailed)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("applyAll() error = %v, want %v", err, tt.wantErr)
+				}
+				if len(applyErr.RollbackErrors) > 0 {
+					t.Errorf("RollbackErrors = %v", applyErr.RollbackErrors)
+				}
+				rolledBack := append([]string{}, applyErr.RolledBack...)
+				sort.Strings(rolledBack)
+				wantRolledBack := tt.wantRolledBack
+				if wantRolledBack == nil {
+					wantRolledBack = tt.wantApplied
+				}
+				wantRolledBack = append([]string{}, wantRolledBack...)
+				sort.Strings(wantRolledBack)
+				if !equalStrings(rolledBack, wantRolledBack) {
+					t.Errorf("RolledBack = %v, want %v", applyErr.RolledBack, wantRolledBack)
+				}
+			}
+			if tt.wantApplied != nil && !equalStrings(applied, tt.wantApplied) {
+				t.Errorf("applied %v, want %v", applied, tt.wantApplied)
+			}
+
+			// Neither temporary files nor backups may be left behind
+			got := listTestFiles(t, fsys)
+			if len(got) != len(tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+			for path, content := range tt.want {
+				if got[path] != content {
+					t.Errorf("%s = %q, want %q", path, got[path], content)
+				}
+			}
+			if tt.wantFailed != "" {
+				if _, err := fsys.Stat("/certs"); err == nil {
+					t.Error("created directory /certs was not removed")
+				}
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,314 @@
+package ccoco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+type CopyOptions struct {
+	// Files limits the copy to these files. Every stored file is copied when empty.
+	Files []string
+}
+
+// CopyConfigs copies the stored files of branch from to branch to, replacing
+// the stored copies of to. Files are decrypted and re-encoded on the way, so the
+// copies are valid for the store format of to.
+func (c Ccoco) CopyConfigs(ctx context.Context, from, to string, opts CopyOptions) error {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return ErrNotInitialized
+	}
+	if from == to {
+		return fmt.Errorf("cannot copy the configs of %s onto themselves", from)
+	}
+
+	files, err := c.branchStoredFiles(from)
+	if err != nil {
+		return err
+	}
+	if len(opts.Files) > 0 {
+		stored := map[string]struct{}{}
+		for _, file := range files {
+			stored[file] = struct{}{}
+		}
+		files = []string{}
+		for _, file := range opts.Files {
+			file = filepath.ToSlash(file)
+			if _, ok := stored[file]; !ok {
+				return fmt.Errorf("%s is not stored for %s", file, from)
+			}
+			files = append(files, file)
+		}
+	}
+
+	source, err := c.openStore(from)
+	if err != nil {
+		return err
+	}
+	target, err := c.openStore(to)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := source.Read(file)
+		if err != nil {
+			return err
+		}
+		mode, ok := source.Mode(file)
+		if !ok {
+			mode = 0644
+		}
+		if err := target.Write(file, data, mode, SourceCopy); err != nil {
+			return err
+		}
+	}
+	if err := target.Close(); err != nil {
+		return err
+	}
+
+	c.logger.Info("Copied configs", "from", from, "to", to, "files", len(files))
+	return nil
+}
+
+// CloneConfigs copies every stored file of branch from to the current branch
+func (c Ccoco) CloneConfigs(ctx context.Context, from string) error {
+	branch, err := c.gitClient.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	return c.CopyConfigs(ctx, from, branch, CopyOptions{})
+}
+
+// RenameConfigs moves the stored files of branch old to branch new. It fails
+// when new already has stored files.
+func (c Ccoco) RenameConfigs(ctx context.Context, old, new string) error {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return ErrNotInitialized
+	}
+	if old == new {
+		return fmt.Errorf("%s is already named %s", old, new)
+	}
+
+	files, err := c.branchStoredFiles(old)
+	if err != nil {
+		return err
+	}
+	existing, err := c.branchStoredFiles(new)
+	if err != nil && !errors.Is(err, errNoStoredFiles) {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("%s already has configs", new)
+	}
+
+	// Stored files are moved as they are, their header or manifest entry doesn't name the branch
+	moves := [][2]string{}
+	for _, file := range files {
+		moves = append(moves, [2]string{c.storePath(old, file), c.storePath(new, file)})
+	}
+	if c.configFile.Content.Format() >= StoreFormatManifest {
+		moves = append(moves, [2]string{
+			filepath.Join(c.branchPath(old), ManifestFileName),
+			filepath.Join(c.branchPath(new), ManifestFileName),
+		})
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, move := range moves {
+		if err := c.fs.MkdirAll(filepath.Dir(move[1]), 0755); err != nil {
+			return err
+		}
+		if err := c.fs.Rename(move[0], move[1]); err != nil {
+			return err
+		}
+		c.removeEmptyDirs(filepath.Dir(move[0]))
+	}
+
+	c.logger.Info("Renamed configs", "from", old, "to", new)
+	return nil
+}
+
+// errNoStoredFiles is returned by branchStoredFiles for branches without stored files
+var errNoStoredFiles = errors.New("no configs stored")
+
+// branchStoredFiles returns the files stored for branch
+func (c Ccoco) branchStoredFiles(branch string) ([]string, error) {
+	storedFiles, err := c.listStoredFiles()
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, stored := range storedFiles {
+		if stored.Branch == branch {
+			files = append(files, stored.File)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w for %s", errNoStoredFiles, branch)
+	}
+	return files, nil
+}
+
+// removeEmptyDirs removes dir and its parents while they are empty, up to the configs directory
+func (c Ccoco) removeEmptyDirs(dir string) {
+	configsPath := filepath.Clean(c.configsPath())
+	for dir = filepath.Clean(dir); dir != configsPath && len(dir) > len(configsPath); dir = filepath.Dir(dir) {
+		if err := c.fs.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
+// seedBranch copies the configs of the seed source of branch to branch and
+// returns the source. It returns an empty string when there is nothing to seed from.
+func (c Ccoco) seedBranch(ctx context.Context, branch string) (string, error) {
+	source, err := c.seedSource(branch)
+	if err != nil || source == "" {
+		return "", err
+	}
+	c.logger.Info("Seeding configs", "branch", branch, "from", source)
+	if err := c.CopyConfigs(ctx, source, branch, CopyOptions{}); err != nil {
+		return "", err
+	}
+	return source, nil
+}
+
+// seedSource returns the branch new configs of branch are copied from: the
+// branch with configs whose merge-base with branch is the most recent, or the
+// base profile. It returns an empty string when there is none.
+func (c Ccoco) seedSource(branch string) (string, error) {
+	storedFiles, err := c.listStoredFiles()
+	if err != nil {
+		return "", err
+	}
+	configured := map[string]bool{}
+	for _, stored := range storedFiles {
+		configured[stored.Branch] = true
+	}
+
+	best := ""
+	var bestBase *object.Commit
+	bestIsTip := false
+	commit, err := c.gitClient.BranchCommit(branch)
+	if err != nil {
+		return "", err
+	}
+	if commit != nil {
+		candidates := []string{}
+		for candidate := range configured {
+			if candidate != branch {
+				candidates = append(candidates, candidate)
+			}
+		}
+		sort.Strings(candidates)
+
+		for _, candidate := range candidates {
+			candidateCommit, err := c.gitClient.BranchCommit(candidate)
+			if err != nil {
+				return "", err
+			}
+			// Not a branch, e.g. the base profile
+			if candidateCommit == nil {
+				continue
+			}
+			bases, err := commit.MergeBase(candidateCommit)
+			if err != nil {
+				return "", err
+			}
+			if len(bases) == 0 {
+				continue
+			}
+
+			// Prefer the most recent fork point, then the branch the fork point is the tip of
+			base := bases[0]
+			isTip := base.Hash == candidateCommit.Hash
+			if bestBase == nil || base.Committer.When.After(bestBase.Committer.When) ||
+				(base.Committer.When.Equal(bestBase.Committer.When) && isTip && !bestIsTip) {
+				best, bestBase, bestIsTip = candidate, base, isTip
+			}
+		}
+	}
+	if best != "" {
+		return best, nil
+	}
+
+	if base := c.configFile.Content.Base; base != "" && base != branch && configured[base] {
+		return base, nil
+	}
+	return "", nil
+}
+
+// PendingRenames returns the renamed branches whose configs are still stored
+// under their old name, following chains of renames to the current name
+func (c Ccoco) PendingRenames() ([]BranchRename, error) {
+	renames, err := c.gitClient.BranchRenames()
+	if err != nil || len(renames) == 0 {
+		return nil, err
+	}
+	branchNames, err := c.gitClient.BranchNames(false, "")
+	if err != nil {
+		return nil, err
+	}
+	live := map[string]bool{}
+	for _, branch := range branchNames {
+		live[branch] = true
+	}
+	storedFiles, err := c.listStoredFiles()
+	if err != nil {
+		return nil, err
+	}
+	configured := map[string]bool{}
+	for _, stored := range storedFiles {
+		configured[stored.Branch] = true
+	}
+
+	pending := []BranchRename{}
+	for branch := range configured {
+		if live[branch] {
+			continue
+		}
+		current := BranchRename{From: branch, To: branch}
+		for _, rename := range renames {
+			if rename.From == current.To {
+				current.To, current.When = rename.To, rename.When
+			}
+		}
+		if current.To != branch && live[current.To] && !configured[current.To] {
+			pending = append(pending, current)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].From < pending[j].From
+	})
+	return pending, nil
+}
+
+// followRename moves the configs of a renamed branch to its new name branch and
+// returns the old name. It returns an empty string when branch wasn't renamed
+// from a branch with configs.
+func (c Ccoco) followRename(ctx context.Context, branch string) (string, error) {
+	pending, err := c.PendingRenames()
+	if err != nil {
+		return "", err
+	}
+	for _, rename := range pending {
+		if rename.To == branch {
+			c.logger.Info("Branch was renamed, moving its configs", "from", rename.From, "to", rename.To)
+			if err := c.RenameConfigs(ctx, rename.From, rename.To); err != nil {
+				return "", err
+			}
+			return rename.From, nil
+		}
+	}
+	return "", nil
+}
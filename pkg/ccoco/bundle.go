@@ -0,0 +1,419 @@
+package ccoco
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// BundleVersion is the version of the bundle metadata written by Export
+const BundleVersion = 1
+
+// bundleMetadataName is the name of the metadata file inside a bundle
+const bundleMetadataName = "ccoco-bundle.json"
+
+// encryptedBundleMagic starts every bundle encrypted with a passphrase
+var encryptedBundleMagic = []byte("CCOCO-BUNDLE-ENCRYPTED-V1\n")
+
+const bundleSaltSize = 16
+
+// Modes of ImportOptions
+const (
+	// ImportMerge adds the files of the bundle to the stored files of each branch
+	ImportMerge = "merge"
+	// ImportReplace removes the stored files of each branch in the bundle before importing
+	ImportReplace = "replace"
+)
+
+// ErrPassphraseRequired is returned when an encrypted bundle is imported without a passphrase
+var ErrPassphraseRequired = errors.New("bundle is encrypted, a passphrase is required")
+
+type (
+	ExportOptions struct {
+		// Branches limits the bundle to these branch directories. Every branch is exported when empty.
+		Branches []string
+		// Passphrase encrypts the bundle when set
+		Passphrase string
+	}
+	ImportOptions struct {
+		// Mode is either ImportMerge (default) or ImportReplace
+		Mode string
+		// Branches limits the import to these branch directories
+		Branches   []string
+		Passphrase string
+	}
+	// BundleMetadata describes the files of a bundle
+	BundleMetadata struct {
+		Version   int          `json:"version"`
+		CreatedAt time.Time    `json:"createdAt"`
+		Files     []BundleFile `json:"files"`
+	}
+	BundleFile struct {
+		// Branch is the branch directory the file was stored for
+		Branch string `json:"branch"`
+		// Path is the target path of the file in the working tree
+		Path string `json:"path"`
+		Mode string `json:"mode"`
+		Hash string `json:"hash"`
+		// Source is where the stored content originally came from, when known
+		Source string `json:"source,omitempty"`
+	}
+)
+
+// IsEncryptedBundle reports whether data starts a bundle encrypted with a passphrase
+func IsEncryptedBundle(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedBundleMagic)
+}
+
+// Export writes the stored files of every branch, or of opts.Branches, to w as a
+// tar.gz bundle. Stored files are decrypted and written without their header, so
+// the bundle can be imported into any store format.
+func (c Ccoco) Export(ctx context.Context, w io.Writer, opts ExportOptions) (*BundleMetadata, error) {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return nil, ErrNotInitialized
+	}
+
+	storedFiles, err := c.listStoredFiles()
+	if err != nil {
+		return nil, err
+	}
+	filter := len(opts.Branches) > 0
+	branches := map[string]bool{}
+	for _, branch := range opts.Branches {
+		branches[branch] = false
+	}
+
+	metadata := &BundleMetadata{Version: BundleVersion, CreatedAt: c.now().UTC(), Files: []BundleFile{}}
+	contents := [][]byte{}
+	stores := map[string]*branchStore{}
+	for _, stored := range storedFiles {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, ok := branches[stored.Branch]; filter && !ok {
+			continue
+		}
+		branches[stored.Branch] = true
+
+		store, exists := stores[stored.Branch]
+		if !exists {
+			store, err = c.openStore(stored.Branch)
+			if err != nil {
+				return nil, err
+			}
+			stores[stored.Branch] = store
+		}
+		data, err := store.Read(stored.File)
+		if err != nil {
+			return nil, err
+		}
+		mode, ok := store.Mode(stored.File)
+		if !ok {
+			mode = 0644
+		}
+		entry, _ := store.manifest.Entry(stored.File)
+
+		metadata.Files = append(metadata.Files, BundleFile{
+			Branch: stored.Branch,
+			Path:   stored.File,
+			Mode:   formatMode(mode),
+			Hash:   hashData(data),
+			Source: entry.Source,
+		})
+		contents = append(contents, data)
+	}
+	for branch, found := range branches {
+		if !found {
+			return nil, fmt.Errorf("no configs stored for %s", branch)
+		}
+	}
+
+	var archive bytes.Buffer
+	if err := writeBundle(&archive, metadata, contents); err != nil {
+		return nil, err
+	}
+
+	data := archive.Bytes()
+	if opts.Passphrase != "" {
+		data, err = encryptBundle(opts.Passphrase, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// Import stores the files of a bundle written by Export
+func (c Ccoco) Import(ctx context.Context, r io.Reader, opts ImportOptions) (*BundleMetadata, error) {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return nil, ErrNotInitialized
+	}
+	mode := opts.Mode
+	if mode == "" {
+		mode = ImportMerge
+	}
+	if mode != ImportMerge && mode != ImportReplace {
+		return nil, fmt.Errorf("invalid import mode %q, expected %s or %s", mode, ImportMerge, ImportReplace)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if IsEncryptedBundle(data) {
+		if opts.Passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		data, err = decryptBundle(opts.Passphrase, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metadata, contents, err := readBundle(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter and validate every file before the store is touched
+	filter := len(opts.Branches) > 0
+	selected := map[string]bool{}
+	for _, branch := range opts.Branches {
+		selected[branch] = false
+	}
+	files := []BundleFile{}
+	for _, file := range metadata.Files {
+		if _, ok := selected[file.Branch]; filter && !ok {
+			continue
+		}
+		selected[file.Branch] = true
+		if !isSafeBundlePath(file.Branch) || !isSafeBundlePath(file.Path) {
+			return nil, fmt.Errorf("invalid path %s/%s in bundle", file.Branch, file.Path)
+		}
+		if _, ok := contents[bundleContentName(file)]; !ok {
+			return nil, fmt.Errorf("%s/%s is missing from the bundle", file.Branch, file.Path)
+		}
+		if hashData(contents[bundleContentName(file)]) != file.Hash {
+			return nil, fmt.Errorf("%s/%s is corrupted", file.Branch, file.Path)
+		}
+		files = append(files, file)
+	}
+	for branch, found := range selected {
+		if !found {
+			return nil, fmt.Errorf("%s is not in the bundle", branch)
+		}
+	}
+
+	storedFiles, err := c.listStoredFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	// Last chance to cancel, the stores are changed from here on
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stores := map[string]*branchStore{}
+	for _, file := range files {
+		store, exists := stores[file.Branch]
+		if !exists {
+			store, err = c.openStore(file.Branch)
+			if err != nil {
+				return nil, err
+			}
+			stores[file.Branch] = store
+
+			if mode == ImportReplace {
+				for _, stored := range storedFiles {
+					if stored.Branch != file.Branch {
+						continue
+					}
+					if err := store.Delete(stored.File); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+
+		fileMode, err := ManifestEntry{Mode: file.Mode}.FileMode()
+		if err != nil {
+			return nil, fmt.Errorf("invalid mode of %s/%s: %w", file.Branch, file.Path, err)
+		}
+		if err := store.Write(file.Path, contents[bundleContentName(file)], fileMode, SourceImport); err != nil {
+			return nil, err
+		}
+	}
+	for _, store := range stores {
+		if err := store.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	c.logger.Info("Imported configs", "files", len(files), "branches", len(stores))
+	metadata.Files = files
+	return metadata, nil
+}
+
+// bundleContentName returns the name of the content of file inside a bundle
+func bundleContentName(file BundleFile) string {
+	return path.Join("files", file.Branch, file.Path)
+}
+
+// isSafeBundlePath reports whether p stays inside the directory it is joined to
+func isSafeBundlePath(p string) bool {
+	clean := path.Clean(p)
+	return p != "" && !path.IsAbs(clean) && clean != ".." && !strings.HasPrefix(clean, "../") && !strings.Contains(p, "\\")
+}
+
+// writeBundle writes metadata and the content of its files as a tar.gz archive
+func writeBundle(w io.Writer, metadata *BundleMetadata, contents [][]byte) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	metadataData, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	write := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: metadata.CreatedAt,
+			Format:  tar.FormatPAX,
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := write(bundleMetadataName, append(metadataData, '\n')); err != nil {
+		return err
+	}
+	for i, file := range metadata.Files {
+		if err := write(bundleContentName(file), contents[i]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// readBundle reads the metadata and file contents of a tar.gz bundle
+func readBundle(r io.Reader) (*BundleMetadata, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	defer gz.Close()
+
+	var metadata *BundleMetadata
+	contents := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		if header.Name == bundleMetadataName {
+			metadata = &BundleMetadata{}
+			if err := json.Unmarshal(data, metadata); err != nil {
+				return nil, nil, fmt.Errorf("invalid bundle metadata: %w", err)
+			}
+			continue
+		}
+		contents[header.Name] = data
+	}
+
+	if metadata == nil {
+		return nil, nil, errors.New("invalid bundle: no metadata")
+	}
+	if metadata.Version > BundleVersion {
+		return nil, nil, fmt.Errorf("bundle version %d is newer than this version of ccoco", metadata.Version)
+	}
+	return metadata, contents, nil
+}
+
+// bundleKey derives the key of an encrypted bundle from passphrase
+func bundleKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, KeySize)
+}
+
+// encryptBundle seals data with a key derived from passphrase
+func encryptBundle(passphrase string, data []byte) ([]byte, error) {
+	salt := make([]byte, bundleSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	key, err := bundleKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, encryptedBundleMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, encryptedBundleMagic), nil
+}
+
+// decryptBundle opens data sealed by encryptBundle
+func decryptBundle(passphrase string, data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(data, encryptedBundleMagic)
+	if len(data) < bundleSaltSize {
+		return nil, errors.New("encrypted bundle is truncated")
+	}
+	key, err := bundleKey(passphrase, data[:bundleSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	data = data[bundleSaltSize:]
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted bundle is truncated")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], encryptedBundleMagic)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or corrupted bundle")
+	}
+	return plain, nil
+}
@@ -1,17 +1,19 @@
 package ccoco
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
-	"github.com/btcsuite/btcd/btcutil/base58"
-	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-billy/v5"
 )
 
 const DefaultConfigFile = "ccoco.config.json"
@@ -24,32 +26,76 @@ type Ccoco struct {
 	gitClient   *Git
 	directories *Directories
 	configFile  *File
+	logger      *slog.Logger
+	now         func() time.Time
+	fs          billy.Filesystem
+	dryRun      bool
+	observers   []Observer
+	// storeCache is the clone of the store repository, found when the config file is loaded
+	storeCache string
 }
 
-func New() (*Ccoco, error) {
-	gitClient, err := NewGitClient(".")
-	if err != nil {
-		return nil, err
+// Option configures a Ccoco instance
+type Option func(*Ccoco)
+
+// WithLogger sets the logger of the instance. Nothing is logged by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Ccoco) {
+		c.logger = logger
 	}
-	directories := &Directories{
-		Root:       DefaultRootDirectory,
-		Configs:    DefaultConfigDirectory,
-		Preflights: DefaultPreflightDirectory,
+}
+
+// WithDirectories sets the ccoco directories, relative to the repository root
+func WithDirectories(directories *Directories) Option {
+	return func(c *Ccoco) {
+		c.directories = directories
 	}
-	configFile := &File{
-		Name: DefaultConfigFile,
-		Content: &FileContent{
-			Files: []string{".env"},
-		},
+}
+
+// WithConfigPath sets the path of the config file, relative to the repository root
+func WithConfigPath(path string) Option {
+	return func(c *Ccoco) {
+		c.configFile = &File{Name: filepath.ToSlash(path), Content: c.configFile.Content}
 	}
+}
+
+// WithClock sets the source of the time recorded in manifests, bundles and commits
+func WithClock(now func() time.Time) Option {
+	return func(c *Ccoco) {
+		c.now = now
+	}
+}
+
+// WithFilesystem sets the filesystem holding the working tree and the store.
+// Paths are resolved like the os package does, relative to the current
+// directory, so an in-memory filesystem should be paired with a git client
+// from NewGitClientFromRepository. Defaults to the filesystem of the OS.
+func WithFilesystem(fs billy.Filesystem) Option {
+	return func(c *Ccoco) {
+		c.fs = fs
+	}
+}
+
+// WithDryRun computes every change without writing it. Changes are kept in
+// memory on top of the filesystem, where Filesystem shows them, and the git
+// index and hooks are left alone.
+func WithDryRun() Option {
+	return func(c *Ccoco) {
+		c.dryRun = true
+	}
+}
 
-	instance, err := NewWithOptions(gitClient, directories, configFile)
+// Open opens the git repository containing repoPath and loads its config file
+// when ccoco is initialized in it
+func Open(ctx context.Context, repoPath string, opts ...Option) (*Ccoco, error) {
+	instance, err := OpenUnloaded(ctx, repoPath, opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	if instance.IsInitialized() {
-		data, err := os.ReadFile(filepath.Join(gitClient.RootPathFromCwd, configFile.Name))
+		configFile := instance.configFile
+		data, err := readFile(instance.fs, filepath.Join(instance.gitClient.RootPathFromCwd, configFile.Name))
 		if err != nil {
 			return nil, err
 		}
@@ -67,17 +113,65 @@ func New() (*Ccoco, error) {
 	return instance, nil
 }
 
-func NewWithOptions(gitClient *Git, directories *Directories, configFile *File) (*Ccoco, error) {
+// OpenUnloaded opens the git repository containing repoPath with the default
+// config without reading the config file, e.g. to inspect a repository whose
+// config file is broken
+func OpenUnloaded(ctx context.Context, repoPath string, opts ...Option) (*Ccoco, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	gitClient, err := NewGitClient(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	directories := &Directories{
+		Root:       DefaultRootDirectory,
+		Configs:    DefaultConfigDirectory,
+		Preflights: DefaultPreflightDirectory,
+	}
+	configFile := &File{
+		Name: DefaultConfigFile,
+		Content: &FileContent{
+			Files: []string{".env"},
+		},
+	}
+
+	return NewWithOptions(gitClient, directories, configFile, opts...)
+}
+
+// New opens the repository of the current directory, see Open
+func New(opts ...Option) (*Ccoco, error) {
+	return Open(context.Background(), ".", opts...)
+}
+
+// NewUnloaded opens the repository of the current directory without reading its config file, see OpenUnloaded
+func NewUnloaded(opts ...Option) (*Ccoco, error) {
+	return OpenUnloaded(context.Background(), ".", opts...)
+}
+
+func NewWithOptions(gitClient *Git, directories *Directories, configFile *File, opts ...Option) (*Ccoco, error) {
 	ccoco := &Ccoco{
 		gitClient:   gitClient,
 		directories: directories,
 		configFile:  configFile,
+		logger:      discardLogger(),
+		now:         time.Now,
+		fs:          newOSFilesystem(),
+	}
+	for _, opt := range opts {
+		opt(ccoco)
+	}
+	if ccoco.dryRun && ccoco.fs != nil {
+		ccoco.fs = NewOverlayFilesystem(ccoco.fs)
 	}
 
 	// Check state if valid
 	if err := ccoco.CheckState(); err != nil {
 		return nil, err
 	}
+	if err := ccoco.locateStore(); err != nil {
+		return nil, err
+	}
 
 	return ccoco, nil
 }
@@ -94,10 +188,36 @@ func (c Ccoco) ConfigFile() *File {
 	return c.configFile
 }
 
+func (c Ccoco) Logger() *slog.Logger {
+	return c.logger
+}
+
+func (c Ccoco) Filesystem() billy.Filesystem {
+	return c.fs
+}
+
+func (c Ccoco) DryRun() bool {
+	return c.dryRun
+}
+
 func (c Ccoco) CheckState() error {
 	if c.gitClient == nil {
 		return errors.New("git client is nil")
 	}
+	if c.logger == nil {
+		return errors.New("logger is nil")
+	}
+	if c.now == nil {
+		return errors.New("clock is nil")
+	}
+	if c.fs == nil {
+		return errors.New("filesystem is nil")
+	}
+	for _, observer := range c.observers {
+		if observer == nil {
+			return errors.New("observer is nil")
+		}
+	}
 	if err := c.gitClient.CheckState(); err != nil {
 		return err
 	}
@@ -124,15 +244,15 @@ type InitOptions struct {
 	AddToGitHooksOptions
 }
 
-func (c Ccoco) Init(opts InitOptions) error {
+func (c Ccoco) Init(ctx context.Context, opts InitOptions) error {
 	// Create directories
-	if err := os.MkdirAll(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Root), 0755); err != nil {
+	if err := c.fs.MkdirAll(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Root), 0755); err != nil {
 		return err
 	}
-	if err := os.MkdirAll(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Configs), 0755); err != nil {
+	if err := c.fs.MkdirAll(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Configs), 0755); err != nil {
 		return err
 	}
-	if err := os.MkdirAll(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Preflights), 0755); err != nil {
+	if err := c.fs.MkdirAll(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Preflights), 0755); err != nil {
 		return err
 	}
 
@@ -143,41 +263,42 @@ func (c Ccoco) Init(opts InitOptions) error {
 	}
 
 	if opts.AddToGitHooks {
-		if err := c.AddToGitHooks(opts.AddToGitHooksOptions); err != nil {
+		if err := c.AddToGitHooks(ctx, opts.AddToGitHooksOptions); err != nil {
 			return err
 		}
 	}
 
 	// Create config file if it doesn't exist with default values
 	ccocoConfigFile := filepath.Join(c.gitClient.RootPathFromCwd, c.configFile.Name)
-	if _, err := os.Stat(ccocoConfigFile); os.IsNotExist(err) {
+	if _, err := c.fs.Stat(ccocoConfigFile); os.IsNotExist(err) {
 		configData, err := json.MarshalIndent(&FileContent{
-			Files: []string{".env"},
+			StoreFormat: LatestStoreFormat,
+			Files:       []string{".env"},
 		}, "", "  ")
 		if err != nil {
 			return err
 		}
-		if err := os.WriteFile(ccocoConfigFile, configData, 0644); err != nil {
+		if err := writeFile(c.fs, ccocoConfigFile, configData, 0644); err != nil {
 			return err
 		}
 	}
 
-	log.Printf("Initialized ccoco-related files and directories at %s", c.gitClient.RootPathFromCwd)
+	c.logger.Info("Initialized ccoco-related files and directories", "root", c.gitClient.RootPathFromCwd)
 
 	return nil
 }
 
 func (c Ccoco) IsInitialized() bool {
-	if _, err := os.Stat(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Root)); os.IsNotExist(err) {
+	if _, err := c.fs.Stat(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Root)); os.IsNotExist(err) {
 		return false
 	}
-	if _, err := os.Stat(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Configs)); os.IsNotExist(err) {
+	if _, err := c.fs.Stat(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Configs)); os.IsNotExist(err) {
 		return false
 	}
-	if _, err := os.Stat(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Preflights)); os.IsNotExist(err) {
+	if _, err := c.fs.Stat(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Preflights)); os.IsNotExist(err) {
 		return false
 	}
-	if _, err := os.Stat(filepath.Join(c.gitClient.RootPathFromCwd, c.configFile.Name)); os.IsNotExist(err) {
+	if _, err := c.fs.Stat(filepath.Join(c.gitClient.RootPathFromCwd, c.configFile.Name)); os.IsNotExist(err) {
 		return false
 	}
 
@@ -203,7 +324,10 @@ func (c *Ccoco) Load(opts LoadOptions) error {
 	if opts.ConfigFile != nil {
 		c.configFile = opts.ConfigFile
 	}
-	return nil
+	if err := c.configFile.CheckState(); err != nil {
+		return fmt.Errorf("invalid %s: %w", c.configFile.Name, err)
+	}
+	return c.locateStore()
 }
 
 func (c Ccoco) AddToGitIgnore() error {
@@ -213,63 +337,85 @@ func (c Ccoco) AddToGitIgnore() error {
 	gitignoreData := []byte("# ccoco directory\n" + c.directories.Root + "\n")
 
 	// Create root .gitignore if it doesn't exist and write root directory in it
-	if _, err := os.Stat(gitignoreFile); os.IsNotExist(err) {
-		if err := os.WriteFile(gitignoreFile, gitignoreData, 0644); err != nil {
+	if _, err := c.fs.Stat(gitignoreFile); os.IsNotExist(err) {
+		if err := writeFile(c.fs, gitignoreFile, gitignoreData, 0644); err != nil {
 			return err
 		}
 	} else if err == nil {
-		gitignoreFileData, err := os.ReadFile(gitignoreFile)
+		gitignoreFileData, err := readFile(c.fs, gitignoreFile)
 		if err != nil {
-			log.Printf("Error reading file %s: %v", gitignoreFile, err)
+			c.logger.Error("Failed to read file", "file", gitignoreFile, "error", err)
 		}
 		// Check if root directory is already in .gitignore
 		if !strings.Contains(string(gitignoreFileData), c.directories.Root) {
 			// Append root directory to .gitignore
 			gitignoreFileData = append(gitignoreFileData, []byte("\n# ccoco directory\n"+c.directories.Root+"\n")...)
-			if err := os.WriteFile(gitignoreFile, gitignoreFileData, 0644); err != nil {
+			if err := writeFile(c.fs, gitignoreFile, gitignoreFileData, 0644); err != nil {
 				return err
 			}
 		} else {
-			log.Printf("Root .gitignore already contains %s", c.directories.Root)
+			c.logger.Info("Root .gitignore already contains the ccoco directory", "directory", c.directories.Root)
 		}
 	}
 	return nil
 }
 
+// Git hooks ccoco can be injected into
+const (
+	HookPostCheckout = "post-checkout"
+	HookPreCommit    = "pre-commit"
+)
+
 type AddToGitHooksOptions struct {
 	SkipExecution bool
+	// Hooks lists the git hooks to inject ccoco into. Defaults to HookPostCheckout.
+	Hooks []string
+	// Force replaces hooks that were not written by ccoco
+	Force bool
 }
 
-func (c Ccoco) AddToGitHooks(opts AddToGitHooksOptions) error {
-
-	script := `#!/bin/sh
-# Skip ccoco if SKIP_CCOCO is set to 1
-if [ "$SKIP_CCOCO" = "1" ]; then
-	echo "SKIP_CCOCO is set to 1, skipping ccoco."
-	exit 0
-fi
-	
-	# Run all preflight scripts
-for file in ./` + c.directories.Preflights + `/*; do
-	# Check if the file is executable
-	if [ -x "$file" ]; then
-		echo "Running $file"
-		"$file"
-	else
-		echo "Cannot execute $file. Skipping."
-	fi
-done
-
-# Run ccoco
-`
+func (c Ccoco) AddToGitHooks(ctx context.Context, opts AddToGitHooksOptions) error {
+	hooks := opts.Hooks
+	if len(hooks) == 0 {
+		hooks = []string{HookPostCheckout}
+	}
+	for _, hook := range hooks {
+		if hook != HookPostCheckout && hook != HookPreCommit {
+			return fmt.Errorf("unsupported git hook %s", hook)
+		}
+		if opts.Force {
+			continue
+		}
+		// Refuse to replace the hooks of other tools
+		command := "run"
+		if hook == HookPreCommit {
+			command = "guard"
+		}
+		path := filepath.Join(c.gitClient.RootPathFromCwd, ".git/hooks", hook)
+		if _, ours, err := hookExecutable(c.fs, path, command); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		} else if err == nil && !ours {
+			return fmt.Errorf("%w: %s, use ccoco githook --force to replace it", ErrHookConflict, path)
+		}
+	}
 
 	// Get the absolute path of the git worktree root
 	absRootPath, err := filepath.Abs(c.gitClient.RootPathFromCwd)
 	if err != nil {
 		return err
 	}
+	// Resolve the ccoco executable when it was run from the PATH or a relative path
+	executablePath := os.Args[0]
+	if !strings.ContainsAny(executablePath, `/\`) {
+		if executablePath, err = exec.LookPath(executablePath); err != nil {
+			return err
+		}
+	}
+	if executablePath, err = filepath.Abs(executablePath); err != nil {
+		return err
+	}
 	// Get the relative path from the git worktree root to ccoco executable
-	relativePath, err := filepath.Rel(absRootPath, os.Args[0])
+	relativePath, err := filepath.Rel(absRootPath, executablePath)
 	if err != nil {
 		return err
 	}
@@ -278,287 +424,863 @@ done
 		relativePath = filepath.ToSlash(relativePath)
 	}
 
-	script += relativePath + " run"
-
-	path := filepath.Join(c.gitClient.RootPathFromCwd, ".git/hooks/post-checkout")
+	for _, hook := range hooks {
+		script := c.postCheckoutScript(relativePath)
+		if hook == HookPreCommit {
+			script = preCommitScript(relativePath)
+		}
 
-	// Write the post-checkout hook script to the file
-	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
-		return err
-	}
+		path := filepath.Join(c.gitClient.RootPathFromCwd, ".git/hooks", hook)
 
-	// Execute the post-checkout hook when SkipExecution is false
-	if !opts.SkipExecution {
-		executable := exec.Command("/bin/sh", path)
-		executable.Stdout = os.Stdout
-		executable.Stderr = os.Stderr
-		err = executable.Run()
-		if err != nil {
+		// Write the hook script to the file
+		if err := writeFile(c.fs, path, []byte(script), 0755); err != nil {
 			return err
 		}
-	} else {
-		log.Println("Skipped post-checkout hook execution")
-	}
 
-	log.Println("Post-checkout hook injected")
+		// Execute the post-checkout hook when SkipExecution is false
+		if hook == HookPostCheckout {
+			if !opts.SkipExecution && !c.dryRun {
+				executable := exec.CommandContext(ctx, "/bin/sh", path)
+				executable.Stdout = os.Stdout
+				executable.Stderr = os.Stderr
+				err = executable.Run()
+				if err != nil {
+					return err
+				}
+			} else {
+				c.logger.Info("Skipped post-checkout hook execution")
+			}
+		}
+
+		c.logger.Info("Injected git hook", "hook", hook)
+	}
 
 	return nil
 }
 
+// postCheckoutScript returns the post-checkout hook running the preflights and ccoco
+func (c Ccoco) postCheckoutScript(executable string) string {
+	return `#!/bin/sh
+# Skip ccoco if SKIP_CCOCO is set to 1
+if [ "$SKIP_CCOCO" = "1" ]; then
+	echo "SKIP_CCOCO is set to 1, skipping ccoco."
+	exit 0
+fi
+	
+	# Run all preflight scripts
+for file in ./` + c.directories.Preflights + `/*; do
+	# Check if the file is executable
+	if [ -x "$file" ]; then
+		echo "Running $file"
+		"$file"
+	else
+		echo "Cannot execute $file. Skipping."
+	fi
+done
+
+# Run ccoco
+` + executable + " run"
+}
+
+// preCommitScript returns the pre-commit hook blocking commits of ccoco configs
+func preCommitScript(executable string) string {
+	return `#!/bin/sh
+# Block commits containing ccoco configs, skipped when SKIP_CCOCO or SKIP_CCOCO_GUARD is set to 1
+` + executable + " guard"
+}
+
 type RunOptions struct {
 	ForceToBranch *string
 }
 
-func (c Ccoco) Run(opts RunOptions) error {
+func (c Ccoco) Run(ctx context.Context, opts RunOptions) (result *RunResult, err error) {
+	// Observers always hear how the run ended, also when it stopped before planning anything
+	start := c.now()
+	currentBranch, configBranch := "", ""
+	defer func() { c.afterApply(currentBranch, configBranch, start, result, err) }()
+
 	// Check if configs are initialized
 	if !c.IsInitialized() {
-		return errors.New("ccoco is not initialized properly. please reinitialize it")
+		return nil, ErrNotInitialized
 	}
 	// Get current branch from options
-	currentBranch := ""
-	if opts.ForceToBranch == nil || currentBranch == "" {
+	if opts.ForceToBranch == nil || *opts.ForceToBranch == "" {
 		// Get current branch from git
-		currentBranchInfo, err := c.gitClient.Repository.Head()
+		branch, err := c.gitClient.CurrentBranch()
 		if err != nil {
-			log.Fatalf("Error getting current branch: %v", err)
+			return nil, fmt.Errorf("error getting current branch: %w", err)
 		}
-		currentBranch = currentBranchInfo.Name().Short()
+		currentBranch = branch
 	} else {
 		currentBranch = *opts.ForceToBranch
 	}
 
-	if strings.Contains(currentBranch, "/") {
-		log.Printf("Current branch is a sub-branch: %s", currentBranch)
-
-		// Split current branch path
-		splitCurrentBranch := strings.Split(currentBranch, "/")
-
-		// Initialize sub-branch path for looping
-		subBranchPath := ""
+	renamedFrom, seededFrom := "", ""
+	configBranch, err = c.resolveConfigBranch(currentBranch)
+	if err != nil && !errors.Is(err, ErrNoConfig) {
+		return nil, err
+	}
+	if err != nil {
+		// Renamed branches take their configs along, new branches are seeded
+		var followErr error
+		renamedFrom, followErr = c.followRename(ctx, currentBranch)
+		if followErr != nil {
+			return nil, fmt.Errorf("%w: %w", ErrRenameFailed, followErr)
+		}
+		if renamedFrom == "" {
+			seededFrom, followErr = c.seedBranch(ctx, currentBranch)
+			if followErr != nil {
+				return nil, fmt.Errorf("%w: %w", ErrSeedFailed, followErr)
+			}
+			if seededFrom == "" {
+				return nil, err
+			}
+		}
+		configBranch = currentBranch
+	}
 
-		// Check if sub-branch exists
-		isSuccess := false
+	return c.applyConfigs(ctx, &RunResult{
+		Branch:       currentBranch,
+		ConfigBranch: configBranch,
+		RenamedFrom:  renamedFrom,
+		SeededFrom:   seededFrom,
+	})
+}
 
-		// Iterate through sub-branches from child to parent
-		for i := len(splitCurrentBranch) - 1; i > 0; i-- {
-			// Get current sub-branch path
-			subBranchPath = strings.Join(splitCurrentBranch[:i], "/")
-			path := filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Configs, subBranchPath)
+// ConfigBranch returns the branch directory the configs of the current branch are applied from
+func (c Ccoco) ConfigBranch() (string, error) {
+	branch, err := c.gitClient.CurrentBranch()
+	if err != nil {
+		return "", err
+	}
+	return c.resolveConfigBranch(branch)
+}
 
-			// Check if path exists
-			info, err := os.Stat(path)
-			if err != nil {
-				log.Printf("Failed to stat current path: %v", err)
-				continue
-			}
+// resolveConfigBranch returns the closest branch directory for branch. Sub-branches
+// are checked from child to parent until the root of the sub-branch is reached.
+func (c Ccoco) resolveConfigBranch(branch string) (string, error) {
+	if strings.Contains(branch, "/") {
+		c.logger.Debug("Current branch is a sub-branch", "branch", branch)
+	}
 
-			// Check if path is a directory
-			if !info.IsDir() {
-				log.Printf("Current path is not a directory: %s", subBranchPath)
-				continue
-			}
+	storedFiles, err := c.listStoredFiles()
+	if err != nil {
+		return "", err
+	}
 
-			if err := c.ChangeConfigFiles(subBranchPath); err != nil {
-				return err
-			}
+	// Split current branch path
+	splitBranch := strings.Split(branch, "/")
 
-			isSuccess = true
-		}
-		if !isSuccess {
-			return errors.New("failed to find any configs")
-		}
-	} else {
-		path := filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Configs, currentBranch)
+	// Iterate through sub-branches from child to parent
+	for i := len(splitBranch); i > 0; i-- {
+		// Get current sub-branch path
+		subBranchPath := strings.Join(splitBranch[:i], "/")
 
 		// Check if path exists
-		info, err := os.Stat(path)
+		info, err := c.fs.Stat(c.branchPath(subBranchPath))
 		if err != nil {
-			return err
+			c.logger.Debug("No branch directory", "branch", subBranchPath, "error", err)
+			continue
 		}
 
 		// Check if path is a directory
 		if !info.IsDir() {
-			return errors.New("current path is not a directory")
+			c.logger.Debug("Branch path is not a directory", "branch", subBranchPath)
+			continue
 		}
 
-		if err := c.ChangeConfigFiles(currentBranch); err != nil {
-			return err
+		// Skip directories that only hold the configs of other sub-branches, e.g. feature for feature/x
+		if !c.isBranchDirectory(subBranchPath, storedFiles) {
+			c.logger.Debug("Branch directory only holds sub-branches", "branch", subBranchPath)
+			continue
 		}
+
+		return subBranchPath, nil
 	}
-	return nil
+
+	if err := c.checkStoreSynced(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%w for %s", ErrNoConfig, branch)
 }
 
-func (c Ccoco) ChangeConfigFiles(currentBranch string) error {
+// isBranchDirectory reports whether the directory of branch holds its own configs
+// rather than only the directories of sub-branches. Branch directories are marked
+// by their manifest, or by their files directory in stores without one.
+func (c Ccoco) isBranchDirectory(branch string, storedFiles []storedFile) bool {
+	switch format := c.configFile.Content.Format(); {
+	case format >= StoreFormatManifest:
+		_, err := c.fs.Stat(filepath.Join(c.branchPath(branch), ManifestFileName))
+		return err == nil
+	case format == StoreFormatMirrored:
+		_, err := c.fs.Stat(filepath.Join(c.branchPath(branch), StoreFilesDir))
+		return err == nil
+	}
+
+	nested := false
+	for _, stored := range storedFiles {
+		if stored.Branch == branch {
+			return true
+		}
+		if strings.HasPrefix(stored.Branch, branch+"/") {
+			nested = true
+		}
+	}
+	return !nested
+}
+
+// ChangeConfigFiles applies the config set of currentBranch to the working tree.
+// Either every file is applied or, on failure, none of them are.
+func (c Ccoco) ChangeConfigFiles(ctx context.Context, currentBranch string) (result *RunResult, err error) {
+	start := c.now()
+	defer func() { c.afterApply(currentBranch, currentBranch, start, result, err) }()
+	return c.applyConfigs(ctx, &RunResult{Branch: currentBranch, ConfigBranch: currentBranch})
+}
+
+// applyConfigs applies the config set of result.ConfigBranch and fills in result.Files,
+// keeping the observers informed. Its callers notify them once it returns.
+func (c Ccoco) applyConfigs(ctx context.Context, result *RunResult) (*RunResult, error) {
 	// Check if configs are initialized
 	if !c.IsInitialized() {
-		return errors.New("ccoco is not initialized properly. please reinitialize it")
+		return nil, ErrNotInitialized
 	}
+	currentBranch := result.ConfigBranch
 
-	for _, file := range c.configFile.Content.Files {
-		// Encode file name to base58
-		encodedFile := file
-		if strings.Contains(file, "/") {
-			encodedFile = filepath.Base(file) + "-" + base58.Encode([]byte(filepath.Dir(file)))
+	store, err := c.openStore(currentBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, operations, err := c.planApply(store)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.preflight(PreflightEvent{
+		Branch:       result.Branch,
+		ConfigBranch: currentBranch,
+		RenamedFrom:  result.RenamedFrom,
+		SeededFrom:   result.SeededFrom,
+		Files:        statuses,
+		DryRun:       c.dryRun,
+	}); err != nil {
+		return nil, err
+	}
+
+	// Refuse to touch anything when a file must not be left as it is
+	for _, status := range statuses {
+		if status.Action == ActionFail {
+			return nil, fmt.Errorf("%w: no stored copy of %s for %s", ErrNoConfig, status.File, currentBranch)
 		}
+	}
 
-		// Read data from current path
-		data, err := os.ReadFile(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Configs, currentBranch, encodedFile))
-		if err != nil {
-			log.Printf("Failed to read current path: %v", err)
+	// Hide applied tracked files from git and show restored ones again
+	skip, clear := []string{}, []string{}
+	for _, status := range statuses {
+		if !status.Tracked {
 			continue
 		}
+		switch status.Action {
+		case ActionApply, ActionDelete:
+			skip = append(skip, status.File)
+		case ActionRestore:
+			clear = append(clear, status.File)
+		}
+	}
 
-		// Check if file is generated by ccoco
-		if !strings.HasPrefix(string(data), "CCOCO GENERATED FILE - "+file+" - DO NOT REMOVE OR EDIT THIS LINE") {
-			log.Printf("Malformed config file: %s", file)
-			continue
+	finalize := func() error {
+		return c.gitClient.SetSkipWorktree(ctx, skip, clear)
+	}
+	// A dry run leaves the git index alone
+	if c.dryRun {
+		finalize = nil
+	}
+
+	fileEvent := func(status FileStatus, path string) FileEvent {
+		return FileEvent{Branch: result.Branch, ConfigBranch: currentBranch, Status: status, Path: path, DryRun: c.dryRun}
+	}
+	byFile := make(map[string]FileStatus, len(statuses))
+	for _, status := range statuses {
+		byFile[status.File] = status
+	}
+	onApplied := func(operation applyOperation) {
+		c.notify(func(o Observer) { o.OnFileApplied(fileEvent(byFile[operation.File], operation.Path)) })
+	}
+
+	c.notify(func(o Observer) {
+		o.OnBeforeApply(ApplyEvent{Branch: result.Branch, ConfigBranch: currentBranch, Files: statuses, DryRun: c.dryRun})
+	})
+	for _, status := range statuses {
+		if status.Action == ActionKeep || status.Action == ActionSkip {
+			path := filepath.Join(c.gitClient.RootPathFromCwd, status.File)
+			c.notify(func(o Observer) { o.OnFileSkipped(fileEvent(status, path)) })
+		}
+	}
+	if err := applyAll(ctx, c.fs, c.logger, operations, onApplied, finalize); err != nil {
+		return nil, err
+	}
+	result.Files = statuses
+
+	counts := map[string]int{}
+	for _, status := range statuses {
+		counts[status.Action]++
+		switch status.Action {
+		case ActionKeep:
+			c.logger.Info("No stored copy, keeping it", "file", status.File, "branch", currentBranch)
+		case ActionSkip:
+			c.logger.Warn("Skipped file", "file", status.File, "reason", status.Reason)
+		}
+	}
+	c.logger.Info("Applied configs", "branch", currentBranch, "files", counts[ActionApply])
+	if counts[ActionRestore] > 0 {
+		c.logger.Info("Restored files from git", "files", counts[ActionRestore])
+	}
+	if counts[ActionDelete] > 0 {
+		c.logger.Info("Removed files without stored copy", "branch", currentBranch, "files", counts[ActionDelete])
+	}
+
+	return result, nil
+}
+
+// planApply decides what happens to every managed file when store is applied
+// and prepares the operations doing it, without touching the working tree
+func (c Ccoco) planApply(store *branchStore) ([]FileStatus, []applyOperation, error) {
+	files, removals, err := c.applySet(store)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries, err := c.gitClient.IndexEntries()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	statuses := []FileStatus{}
+	operations := []applyOperation{}
+	for _, file := range files {
+		options := c.configFile.Content.OptionsFor(file)
+		path := filepath.Join(c.gitClient.RootPathFromCwd, file)
+		_, tracked := entries[file]
+		status := FileStatus{
+			File:      file,
+			Stored:    store.Exists(file),
+			Tracked:   tracked,
+			OnMissing: options.OnMissingPolicy(),
+		}
+		// Tracked files go back to their committed version unless told otherwise
+		if tracked && options.OnMissing == "" {
+			status.OnMissing = OnMissingRestore
 		}
 
-		// Remove first line from data
-		if strings.Contains(string(data), "\n") {
-			data = []byte(strings.Join(strings.Split(string(data), "\n")[1:], "\n"))
+		var operation *applyOperation
+		if status.Stored {
+			operation, err = c.storedOperation(store, file, path, options)
+			if err != nil {
+				status.Action = ActionSkip
+				status.Reason = err.Error()
+			} else {
+				status.Action = ActionApply
+			}
 		} else {
-			data = []byte("")
+			operation, status.Action, status.Reason, err = c.missingOperation(file, path, status.OnMissing, options)
+			if err != nil {
+				return nil, nil, err
+			}
 		}
 
-		// Remove root path if it exists
-		if err := os.RemoveAll(filepath.Join(c.gitClient.RootPathFromCwd, file)); err != nil {
-			log.Printf("Failed to clear current path: %v", err)
-			continue
+		if operation != nil {
+			operations = append(operations, *operation)
 		}
+		statuses = append(statuses, status)
+	}
 
-		// Write data to root path
-		if err := os.WriteFile(filepath.Join(c.gitClient.RootPathFromCwd, file), data, 0644); err != nil {
-			return err
+	for _, file := range removals {
+		_, tracked := entries[file]
+		statuses = append(statuses, FileStatus{
+			File:    file,
+			Tracked: tracked,
+			Action:  ActionDelete,
+			Reason:  "not stored for " + store.branch,
+		})
+		operations = append(operations, applyOperation{
+			File:   file,
+			Path:   filepath.Join(c.gitClient.RootPathFromCwd, file),
+			Remove: true,
+		})
+	}
+
+	return statuses, operations, nil
+}
+
+// storedOperation prepares applying the stored copy of file
+func (c Ccoco) storedOperation(store *branchStore, file, path string, options FileOptions) (*applyOperation, error) {
+	if options.ApplyMode() == ApplySymlink {
+		operation, err := c.symlinkOperation(store, file, path)
+		if err != nil {
+			return nil, err
 		}
+		return &operation, nil
 	}
 
-	return nil
+	// Read data from current path
+	data, err := store.Read(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the mode of the replaced file unless the store or the config says otherwise
+	mode := os.FileMode(0644)
+	if previous, err := c.fs.Lstat(path); err == nil && previous.Mode().IsRegular() {
+		mode = previous.Mode().Perm()
+	}
+	if storedMode, ok := store.Mode(file); ok {
+		mode = storedMode
+	}
+	overrideMode, ok, err := options.FileMode()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		mode = overrideMode
+	}
+
+	return &applyOperation{
+		File: file,
+		Path: path,
+		Data: data,
+		Mode: mode,
+	}, nil
+}
+
+// missingOperation prepares what policy does to file when the branch has no stored copy
+func (c Ccoco) missingOperation(file, path, policy string, options FileOptions) (*applyOperation, string, string, error) {
+	remove := &applyOperation{File: file, Path: path, Remove: true}
+
+	switch policy {
+	case OnMissingDelete:
+		return remove, ActionDelete, "", nil
+	case OnMissingFail:
+		return nil, ActionFail, "", nil
+	case OnMissingRestore:
+		data, mode, tracked, err := c.gitClient.HeadFile(file)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if !tracked {
+			return remove, ActionDelete, "not tracked by git", nil
+		}
+		if overrideMode, ok, err := options.FileMode(); err != nil {
+			return nil, "", "", err
+		} else if ok {
+			mode = overrideMode
+		}
+		return &applyOperation{File: file, Path: path, Data: data, Mode: mode}, ActionRestore, "", nil
+	default:
+		return nil, ActionKeep, "", nil
+	}
+}
+
+// applySet returns the files to apply from store and the working tree files to remove
+// because a pattern or directory of the config doesn't contain them on this branch
+func (c Ccoco) applySet(store *branchStore) ([]string, []string, error) {
+	files := []string{}
+	stored := map[string]struct{}{}
+	patterns := []string{}
+	for _, entry := range c.configFile.Content.Files {
+		matches := store.Match(entry)
+		// Entries with nothing stored beneath them are single files
+		if !isPattern(entry) && (len(matches) == 0 || (len(matches) == 1 && matches[0] == entry)) {
+			matches = []string{entry}
+		} else {
+			patterns = append(patterns, entry)
+		}
+		for _, file := range matches {
+			if _, exists := stored[file]; !exists {
+				stored[file] = struct{}{}
+				files = append(files, file)
+			}
+		}
+	}
+
+	removals := []string{}
+	removed := map[string]struct{}{}
+	for _, entry := range patterns {
+		working, err := c.expandWorkingTree(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, file := range working {
+			_, isStored := stored[file]
+			_, isRemoved := removed[file]
+			if !isStored && !isRemoved {
+				removed[file] = struct{}{}
+				removals = append(removals, file)
+			}
+		}
+	}
+
+	return files, removals, nil
 }
 
-func (c Ccoco) GenerateConfigs() error {
+// symlinkOperation prepares a symbolic link from path to the stored copy of file
+func (c Ccoco) symlinkOperation(store *branchStore, file, path string) (applyOperation, error) {
+	if c.configFile.Content.Format() < StoreFormatManifest {
+		return applyOperation{}, fmt.Errorf("symlink apply mode requires store format %d, run ccoco migrate", StoreFormatManifest)
+	}
+	if c.configFile.Content.Encrypt {
+		return applyOperation{}, errors.New("symlink apply mode can't be used with an encrypted store")
+	}
+	storePath := c.storePath(store.branch, file)
+	if _, err := c.fs.Stat(storePath); err != nil {
+		return applyOperation{}, err
+	}
+
+	// Link relatively so the repository can be moved around
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return applyOperation{}, err
+	}
+	absStorePath, err := filepath.Abs(storePath)
+	if err != nil {
+		return applyOperation{}, err
+	}
+	target, err := filepath.Rel(filepath.Dir(absPath), absStorePath)
+	if err != nil {
+		return applyOperation{}, err
+	}
+
+	return applyOperation{
+		File:    file,
+		Path:    path,
+		Symlink: target,
+	}, nil
+}
+
+type GenerateOptions struct {
+	// Remotes also generates configs for remote-tracking branches
+	Remotes bool
+	// Remote limits the remote-tracking branches to this remote. Every remote is used when empty.
+	Remote string
+	// Branches limits the generated branches to those matching one of these globs
+	Branches []string
+}
+
+func (c Ccoco) GenerateConfigs(ctx context.Context, opts GenerateOptions) (*GenerateResult, error) {
 	// Check if configs are initialized
 	if !c.IsInitialized() {
-		return errors.New("ccoco is not initialized properly. please reinitialize it")
+		return nil, ErrNotInitialized
 	}
 
 	headBranchInfo, err := c.gitClient.Repository.Head()
 	if err != nil {
-		log.Printf("Error getting current branch: %v", err)
-		return err
+		return nil, err
 	}
 	headBranch := headBranchInfo.Name().Short()
 
-	// Get all branches
-	branches, err := c.gitClient.Repository.Branches()
+	if opts.Remote != "" {
+		if _, err := c.gitClient.Repository.Remote(opts.Remote); err != nil {
+			return nil, fmt.Errorf("failed to find remote %s: %w", opts.Remote, err)
+		}
+	}
+	for _, pattern := range opts.Branches {
+		if err := checkPattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid branch pattern %s: %w", pattern, err)
+		}
+	}
+
+	// Get all branches, HEAD first so the other branches can be seeded from it
+	branchNames, err := c.gitClient.BranchNames(opts.Remotes || opts.Remote != "", opts.Remote)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	branches := []string{}
+	for _, branch := range branchNames {
+		if !matchBranch(opts.Branches, branch) {
+			continue
+		}
+		if branch == headBranch {
+			branches = append([]string{branch}, branches...)
+		} else {
+			branches = append(branches, branch)
+		}
 	}
 
 	// Generate per-branch config files
-	if err := branches.ForEach(func(branch *plumbing.Reference) error {
-		currentBranch := branch.Name().Short()
+	result := &GenerateResult{Branches: []BranchChange{}}
+	for _, currentBranch := range branches {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		change := BranchChange{Branch: currentBranch, Files: []FileChange{}}
+
+		// New branches start from the configs of their closest ancestor
+		if headBranch != currentBranch {
+			if _, err := c.branchStoredFiles(currentBranch); errors.Is(err, errNoStoredFiles) {
+				change.SeededFrom, err = c.seedBranch(ctx, currentBranch)
+				if err != nil {
+					return nil, err
+				}
+				// Without a seed source the branch is left for run to seed once it is checked out
+				if change.SeededFrom == "" {
+					for _, entry := range c.configFile.Content.Files {
+						change.Files = append(change.Files, FileChange{File: entry, Action: ActionSkip, Reason: "no branch to seed from"})
+					}
+				}
+				result.Branches = append(result.Branches, change)
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+		}
 
 		// Create directory if it doesn't exist
-		if err := os.MkdirAll(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Configs, branch.Name().Short()), 0755); err != nil {
-			return err
+		if err := c.fs.MkdirAll(c.branchPath(currentBranch), 0755); err != nil {
+			return nil, err
 		}
-		for _, file := range c.configFile.Content.Files {
-			// Add actual file name to the first line of the file
-			data := []byte("CCOCO GENERATED FILE - " + file + " - DO NOT REMOVE OR EDIT THIS LINE\n")
-
-			// Encode to base58 to flatten file
-			encodedFile := file
-			if strings.Contains(file, "/") {
-				encodedFile = filepath.Base(file) + "-" + base58.Encode([]byte(filepath.Dir(file)))
+		store, err := c.openStore(currentBranch)
+		if err != nil {
+			return nil, err
+		}
+		// The manifest marks the directory as a branch directory, even without files
+		store.dirty = true
+		for _, entry := range c.configFile.Content.Files {
+			files, expanded, err := c.expandEntry(entry)
+			if err != nil {
+				return nil, err
+			}
+			if expanded {
+				// Patterns and directories only store what exists in the working tree
+				if headBranch != currentBranch {
+					continue
+				}
+			} else {
+				files = []string{entry}
 			}
 
-			if headBranch == currentBranch {
+			for _, file := range files {
+				if store.Exists(file) {
+					change.Files = append(change.Files, FileChange{File: file, Action: ActionSkip, Reason: "already stored"})
+					continue
+				}
+
+				// An empty copy would wipe the working file when the branch is checked out
+				if headBranch != currentBranch {
+					change.Files = append(change.Files, FileChange{File: file, Action: ActionSkip, Reason: "not stored for this branch"})
+					continue
+				}
+
+				data := []byte{}
+				mode := os.FileMode(0644)
+				source := SourceEmpty
+
 				// Read data from root path if it exists
-				fileData, _ := os.ReadFile(filepath.Join(c.gitClient.RootPathFromCwd, file))
-				if fileData != nil || len(fileData) > 0 {
-					data = append(data, fileData...)
+				fileData, info, err := c.readWorkingFile(file)
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					return nil, err
+				}
+				if err == nil {
+					data = fileData
+					mode = info.Mode()
+					source = SourceWorkingTree
 				}
-			}
 
-			if _, err := os.Stat(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Configs, currentBranch, encodedFile)); os.IsNotExist(err) {
 				// Write data to current path
-				if err := os.WriteFile(filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Configs, currentBranch, encodedFile), data, 0644); err != nil {
-					return err
+				if err := store.Write(file, data, mode, source); err != nil {
+					return nil, err
 				}
+				change.Files = append(change.Files, FileChange{File: file, Action: ActionStore, Source: source})
 			}
 		}
-		return nil
-	}); err != nil {
-		return err
+		if err := store.Close(); err != nil {
+			return nil, err
+		}
+		result.Branches = append(result.Branches, change)
 	}
-	return nil
+	return result, nil
+}
+
+type SaveOptions struct {
+	// Files limits the saved files. All files in the config are saved when empty.
+	Files []string
 }
 
-func (c Ccoco) AddToFiles(files []string) error {
+// Save copies the working tree files into the store of the current branch, overwriting stored copies
+func (c Ccoco) Save(ctx context.Context, opts SaveOptions) (*SaveResult, error) {
 	// Check if configs are initialized
 	if !c.IsInitialized() {
-		return errors.New("ccoco is not initialized properly. please reinitialize it")
+		return nil, ErrNotInitialized
 	}
 
-	// Add files to config file
-	filesMap := make(map[string]struct{})
-	for _, file := range c.configFile.Content.Files {
-		filesMap[filepath.ToSlash(file)] = struct{}{}
+	headBranchInfo, err := c.gitClient.Repository.Head()
+	if err != nil {
+		return nil, err
 	}
-	for _, f := range files {
-		if _, exists := filesMap[f]; !exists {
-			c.configFile.Content.Files = append(c.configFile.Content.Files, filepath.ToSlash(f))
+	headBranch := headBranchInfo.Name().Short()
+
+	store, err := c.openStore(headBranch)
+	if err != nil {
+		return nil, err
+	}
+	result := &SaveResult{Branch: headBranch, Files: []FileChange{}}
+
+	// Save only the given files when some are given
+	if len(opts.Files) > 0 {
+		files := []string{}
+		for _, file := range opts.Files {
+			file = filepath.ToSlash(file)
+			if !c.isManaged(file) {
+				return nil, fmt.Errorf("%s is not in %s", file, c.configFile.Name)
+			}
+			files = append(files, file)
+		}
+		for _, file := range files {
+			if err := c.saveFile(store, file); err != nil {
+				return nil, err
+			}
+			result.Files = append(result.Files, FileChange{File: file, Action: ActionStore, Source: SourceWorkingTree})
+		}
+		return result, store.Close()
+	}
+
+	for _, entry := range c.configFile.Content.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		files, expanded, err := c.expandEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		if !expanded {
+			files = []string{entry}
+		}
+
+		for _, file := range files {
+			if err := c.saveFile(store, file); err != nil {
+				return nil, err
+			}
+			result.Files = append(result.Files, FileChange{File: file, Action: ActionStore, Source: SourceWorkingTree})
+		}
+
+		// Drop stored files that no longer exist in the working tree
+		if expanded {
+			saved := map[string]struct{}{}
+			for _, file := range files {
+				saved[file] = struct{}{}
+			}
+			for _, file := range store.Match(entry) {
+				if _, exists := saved[file]; !exists {
+					if err := store.Delete(file); err != nil {
+						return nil, err
+					}
+					c.logger.Info("Removed stored file", "file", file, "branch", headBranch)
+					result.Files = append(result.Files, FileChange{File: file, Action: ActionDelete, Reason: "not in the working tree"})
+				}
+			}
 		}
 	}
 
-	configData, err := json.MarshalIndent(c.configFile.Content, "", "  ")
+	return result, store.Close()
+}
+
+// saveFile copies a single working tree file into store
+func (c Ccoco) saveFile(store *branchStore, file string) error {
+	data, info, err := c.readWorkingFile(file)
 	if err != nil {
 		return err
 	}
-
-	if err := os.RemoveAll(filepath.Join(c.gitClient.RootPathFromCwd, c.configFile.Name)); err != nil {
+	if err := store.Write(file, data, info.Mode(), SourceWorkingTree); err != nil {
 		return err
 	}
+	c.logger.Info("Saved file", "file", file, "branch", store.branch)
+	return nil
+}
 
-	if err := os.WriteFile(filepath.Join(c.gitClient.RootPathFromCwd, c.configFile.Name), configData, 0644); err != nil {
-		return err
+// readWorkingFile reads a regular file from the working tree
+func (c Ccoco) readWorkingFile(file string) ([]byte, os.FileInfo, error) {
+	path := filepath.Join(c.gitClient.RootPathFromCwd, file)
+	info, err := c.fs.Stat(path)
+	if err != nil {
+		return nil, nil, err
 	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, fmt.Errorf("%s is not a regular file", file)
+	}
+	data, err := readFile(c.fs, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, info, nil
+}
 
-	return nil
+// isManaged reports whether file belongs to an entry of the config
+func (c Ccoco) isManaged(file string) bool {
+	for _, entry := range c.configFile.Content.Files {
+		if matchEntry(entry, file) {
+			return true
+		}
+	}
+	return false
 }
 
-func (c Ccoco) RemoveFromFiles(files []string) error {
+func (c Ccoco) AddToFiles(files []string) (*ConfigFilesResult, error) {
 	// Check if configs are initialized
 	if !c.IsInitialized() {
-		return errors.New("ccoco is not initialized properly. please reinitialize it")
+		return nil, ErrNotInitialized
+	}
+
+	// Add files to config file
+	result := &ConfigFilesResult{Files: []FileChange{}}
+	filesMap := make(map[string]struct{})
+	for _, file := range c.configFile.Content.Files {
+		filesMap[entryKey(file)] = struct{}{}
+	}
+	for _, f := range files {
+		f = filepath.ToSlash(f)
+		if _, exists := filesMap[entryKey(f)]; exists {
+			result.Files = append(result.Files, FileChange{File: f, Action: ActionSkip, Reason: "already in " + c.configFile.Name})
+			continue
+		}
+		filesMap[entryKey(f)] = struct{}{}
+		c.configFile.Content.Files = append(c.configFile.Content.Files, f)
+		result.Files = append(result.Files, FileChange{File: f, Action: ActionAdd})
+	}
+	result.Config = c.configFile.Content.Files
+
+	return result, c.writeConfigFile()
+}
+
+func (c Ccoco) RemoveFromFiles(files []string) (*ConfigFilesResult, error) {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return nil, ErrNotInitialized
 	}
 
 	// Remove files from config file
+	result := &ConfigFilesResult{Files: []FileChange{}}
 	filesMap := make(map[string]struct{})
 	for _, file := range files {
-		filesMap[filepath.ToSlash(file)] = struct{}{}
+		filesMap[entryKey(file)] = struct{}{}
 	}
 	newFiles := []string{}
+	removed := map[string]struct{}{}
 	for _, f := range c.configFile.Content.Files {
-		if _, exists := filesMap[f]; !exists {
+		if _, exists := filesMap[entryKey(f)]; !exists {
 			newFiles = append(newFiles, filepath.ToSlash(f))
+			continue
 		}
+		removed[entryKey(f)] = struct{}{}
 	}
-	c.configFile.Content.Files = newFiles
-
-	configData, err := json.MarshalIndent(c.configFile.Content, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	if err := os.RemoveAll(filepath.Join(c.gitClient.RootPathFromCwd, c.configFile.Name)); err != nil {
-		return err
-	}
-
-	if err := os.WriteFile(filepath.Join(c.gitClient.RootPathFromCwd, c.configFile.Name), configData, 0644); err != nil {
-		return err
+	for _, f := range files {
+		f = filepath.ToSlash(f)
+		if _, ok := removed[entryKey(f)]; ok {
+			delete(removed, entryKey(f))
+			result.Files = append(result.Files, FileChange{File: f, Action: ActionRemove})
+		} else {
+			result.Files = append(result.Files, FileChange{File: f, Action: ActionSkip, Reason: "not in " + c.configFile.Name})
+		}
 	}
+	c.configFile.Content.Files = newFiles
+	result.Config = newFiles
 
-	return nil
+	return result, c.writeConfigFile()
 }
@@ -0,0 +1,283 @@
+package ccoco
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// testNow is the clock of every test instance
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestCcoco returns an initialized instance on an in-memory repository and filesystem
+func newTestCcoco(t *testing.T, content *FileContent) *Ccoco {
+	t.Helper()
+	fsys := memfs.New()
+	repository, err := git.Init(memory.NewStorage(), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitClient, err := NewGitClientFromRepository(repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+	directories := &Directories{
+		Root:       DefaultRootDirectory,
+		Configs:    DefaultConfigDirectory,
+		Preflights: DefaultPreflightDirectory,
+	}
+	c, err := NewWithOptions(gitClient, directories, &File{Name: DefaultConfigFile, Content: content},
+		WithFilesystem(fsys),
+		WithClock(func() time.Time { return testNow }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{directories.Root, directories.Configs, directories.Preflights} {
+		if err := fsys.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(fsys, DefaultConfigFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// storeTestFiles stores every file of every branch with its name as content
+func storeTestFiles(t *testing.T, c *Ccoco, branches map[string][]string) {
+	t.Helper()
+	for branch, files := range branches {
+		store, err := c.openStore(branch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A branch without files is still marked as one, like generate does
+		store.dirty = true
+		if c.configFile.Content.Format() == StoreFormatMirrored {
+			if err := c.fs.MkdirAll(filepath.Join(c.branchPath(branch), StoreFilesDir), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, file := range files {
+			if err := store.Write(file, []byte(file), 0600, SourceWorkingTree); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTestFile returns the content of name, or nil when it doesn't exist
+func readTestFile(t *testing.T, fsys billy.Filesystem, name string) []byte {
+	t.Helper()
+	data, err := readFile(fsys, name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestResolveConfigBranch(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   int
+		branches map[string][]string
+		branch   string
+		want     string
+		wantErr  error
+	}{
+		{
+			name:     "branch",
+			format:   StoreFormatManifest,
+			branches: map[string][]string{"main": {".env"}},
+			branch:   "main",
+			want:     "main",
+		},
+		{
+			name:     "sub-branch",
+			format:   StoreFormatManifest,
+			branches: map[string][]string{"feature": {".env"}, "feature/x": {".env"}},
+			branch:   "feature/x",
+			want:     "feature/x",
+		},
+		{
+			name:     "closest parent",
+			format:   StoreFormatManifest,
+			branches: map[string][]string{"feature": {".env"}},
+			branch:   "feature/x/y",
+			want:     "feature",
+		},
+		{
+			name:     "stored file named like a sub-branch",
+			format:   StoreFormatManifest,
+			branches: map[string][]string{"feature": {"x/.env"}},
+			branch:   "feature/x",
+			want:     "feature",
+		},
+		{
+			name:     "directory only holding sub-branches",
+			format:   StoreFormatManifest,
+			branches: map[string][]string{"feature/y": {".env"}},
+			branch:   "feature/x",
+			wantErr:  ErrNoConfig,
+		},
+		{
+			name:     "branch without files",
+			format:   StoreFormatManifest,
+			branches: map[string][]string{"main": {}},
+			branch:   "main",
+			want:     "main",
+		},
+		{
+			name:     "no configs",
+			format:   StoreFormatManifest,
+			branches: map[string][]string{"main": {".env"}},
+			branch:   "develop",
+			wantErr:  ErrNoConfig,
+		},
+		{
+			name:     "mirrored closest parent",
+			format:   StoreFormatMirrored,
+			branches: map[string][]string{"feature": {"x/.env"}, "feature/y/z": {".env"}},
+			branch:   "feature/x",
+			want:     "feature",
+		},
+		{
+			name:     "mirrored directory only holding sub-branches",
+			format:   StoreFormatMirrored,
+			branches: map[string][]string{"feature/y": {".env"}},
+			branch:   "feature/x",
+			wantErr:  ErrNoConfig,
+		},
+		{
+			name:     "flat sub-branch",
+			format:   StoreFormatFlat,
+			branches: map[string][]string{"feature": {".env"}, "feature/x": {".env"}},
+			branch:   "feature/x",
+			want:     "feature/x",
+		},
+		{
+			name:     "flat directory only holding sub-branches",
+			format:   StoreFormatFlat,
+			branches: map[string][]string{"feature/y": {".env"}},
+			branch:   "feature/x",
+			wantErr:  ErrNoConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCcoco(t, &FileContent{StoreFormat: tt.format, Files: []string{".env", "x/.env"}})
+			storeTestFiles(t, c, tt.branches)
+
+			got, err := c.resolveConfigBranch(tt.branch)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolveConfigBranch(%q) error = %v, want %v", tt.branch, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveConfigBranch(%q) = %q, want %q", tt.branch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunStopsOnMalformedStore(t *testing.T) {
+	c := newTestCcoco(t, &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env"}})
+	storeTestFiles(t, c, map[string][]string{"main": {".env"}})
+	if err := writeFile(c.fs, filepath.Join(c.branchPath("main"), ManifestFileName), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A store that can't be read is reported, not taken for a branch without configs
+	branch := "develop"
+	if _, err := c.Run(context.Background(), RunOptions{ForceToBranch: &branch}); !errors.Is(err, ErrMalformedStore) {
+		t.Fatalf("Run() error = %v, want %v", err, ErrMalformedStore)
+	}
+	if _, err := c.fs.Stat(c.branchPath(branch)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s was seeded: %v", branch, err)
+	}
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content *FileContent
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			content: &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env", "certs/*.pem"}, Options: map[string]FileOptions{".env": {Mode: "0600"}}},
+		},
+		{
+			name:    "no files",
+			content: &FileContent{StoreFormat: StoreFormatManifest, Files: []string{}},
+			wantErr: true,
+		},
+		{
+			name:    "file outside of the repository",
+			content: &FileContent{StoreFormat: StoreFormatManifest, Files: []string{"../outside.txt"}},
+			wantErr: true,
+		},
+		{
+			name:    "file outside of the repository in a flat store",
+			content: &FileContent{StoreFormat: StoreFormatFlat, Files: []string{"../outside.txt"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid mode",
+			content: &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env"}, Options: map[string]FileOptions{".env": {Mode: "999"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid default mode",
+			content: &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env"}, Defaults: &FileOptions{Mode: "rw"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown onMissing policy",
+			content: &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env"}, Options: map[string]FileOptions{".env": {OnMissing: "ignore"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid pattern",
+			content: &FileContent{StoreFormat: StoreFormatManifest, Files: []string{"certs/[.pem"}},
+			wantErr: true,
+		},
+		{
+			name:    "encryption of a flat store",
+			content: &FileContent{StoreFormat: StoreFormatFlat, Files: []string{".env"}, Encrypt: true},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCcoco(t, &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env"}})
+
+			err := c.Load(LoadOptions{ConfigFile: &File{Name: DefaultConfigFile, Content: tt.content}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
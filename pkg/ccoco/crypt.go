@@ -0,0 +1,279 @@
+package ccoco
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeyEnv holds a base64 encoded key and takes precedence over any key file
+const KeyEnv = "CCOCO_KEY"
+
+// KeyFileEnv overrides the path of the key file
+const KeyFileEnv = "CCOCO_KEY_FILE"
+
+// KeySize is the size of the AES-256 keys used to encrypt stored files
+const KeySize = 32
+
+// encryptedMagic starts every encrypted stored file
+var encryptedMagic = []byte("CCOCO-ENCRYPTED-V1\n")
+
+const keyIDSize = 8
+
+// ErrNoKey is returned when an encrypted file is read or written without a key
+var ErrNoKey = errors.New("no encryption key found, run ccoco keygen or set " + KeyEnv)
+
+// DefaultKeyFile returns the path of the key file in the user's config directory
+func DefaultKeyFile() (string, error) {
+	if path := os.Getenv(KeyFileEnv); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ccoco", "key"), nil
+}
+
+// LoadKey returns the key from KeyEnv or the key file. It returns ErrNoKey when there is none.
+func LoadKey() ([]byte, error) {
+	if encoded := os.Getenv(KeyEnv); encoded != "" {
+		return decodeKey(encoded)
+	}
+	path, err := DefaultKeyFile()
+	if err != nil {
+		return nil, err
+	}
+	return readKeyFile(path)
+}
+
+// readKeyFile returns the key stored at path. It returns ErrNoKey when there is none.
+func readKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeKey(string(data))
+}
+
+// decodeKey decodes a base64 encoded key
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid encryption key: expected %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// GenerateKey returns a new random key
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// WriteKey writes key to the key file, readable by the current user only,
+// and syncs it to disk
+func WriteKey(path string, key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(base64.StdEncoding.EncodeToString(key) + "\n")); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// keyID identifies a key without revealing it
+func keyID(key []byte) []byte {
+	sum := sha256.Sum256(append([]byte("ccoco key id"), key...))
+	return sum[:keyIDSize]
+}
+
+// isEncrypted reports whether data was written by encrypt
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// encrypt seals data with AES-256-GCM
+func encrypt(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, encryptedMagic...)
+	out = append(out, keyID(key)...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, encryptedMagic), nil
+}
+
+// decrypt opens data sealed by encrypt
+func decrypt(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, encryptedMagic)
+	if len(data) < keyIDSize+gcm.NonceSize() {
+		return nil, errors.New("encrypted file is truncated")
+	}
+	if !bytes.Equal(data[:keyIDSize], keyID(key)) {
+		return nil, errors.New("file was encrypted with a different key")
+	}
+	data = data[keyIDSize:]
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], encryptedMagic)
+}
+
+// keyFor returns the key of keys data was encrypted with, or the first key
+// when data isn't encrypted with any of them
+func keyFor(data []byte, keys ...[]byte) []byte {
+	id := bytes.TrimPrefix(data, encryptedMagic)
+	for _, key := range keys {
+		if key != nil && isEncrypted(data) && len(id) >= keyIDSize && bytes.Equal(id[:keyIDSize], keyID(key)) {
+			return key
+		}
+	}
+	return keys[0]
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Rekey re-encrypts every stored file with a new key and replaces the key file.
+// Stored files that aren't encrypted yet are encrypted as well. The new key is
+// synced to <key file>.new before any file is rewritten and only replaces the
+// key file once every file uses it, so an interrupted rekey can be run again.
+func (c Ccoco) Rekey(ctx context.Context) error {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return ErrNotInitialized
+	}
+	if !c.configFile.Content.Encrypt {
+		return fmt.Errorf("encryption is not enabled in %s", c.configFile.Name)
+	}
+	if os.Getenv(KeyEnv) != "" {
+		return fmt.Errorf("cannot replace a key set with %s", KeyEnv)
+	}
+	// The key file is kept outside of the filesystem of the instance
+	if c.dryRun {
+		return ErrDryRun
+	}
+
+	oldKey, err := LoadKey()
+	if err != nil && !errors.Is(err, ErrNoKey) {
+		return err
+	}
+	keyFile, err := DefaultKeyFile()
+	if err != nil {
+		return err
+	}
+	// Files rewritten by an interrupted rekey already use its pending key
+	pendingFile := keyFile + ".new"
+	newKey, err := readKeyFile(pendingFile)
+	if errors.Is(err, ErrNoKey) {
+		newKey, err = GenerateKey()
+	}
+	if err != nil {
+		return err
+	}
+
+	storedFiles, err := c.listStoredFiles()
+	if err != nil {
+		return err
+	}
+
+	// Decrypt everything first so a wrong key doesn't leave a half rekeyed store
+	stores := map[string]*branchStore{}
+	contents := make([][]byte, len(storedFiles))
+	for i, stored := range storedFiles {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		store, exists := stores[stored.Branch]
+		if !exists {
+			store, err = c.openStore(stored.Branch)
+			if err != nil {
+				return err
+			}
+			stores[stored.Branch] = store
+		}
+		data, err := readFile(c.fs, c.storePath(stored.Branch, stored.File))
+		if err != nil {
+			return err
+		}
+		store.key = keyFor(data, oldKey, newKey)
+		contents[i], err = store.Read(stored.File)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := WriteKey(pendingFile, newKey); err != nil {
+		return err
+	}
+	for i, stored := range storedFiles {
+		store := stores[stored.Branch]
+		store.key = newKey
+		mode, ok := store.Mode(stored.File)
+		if !ok {
+			mode = 0644
+		}
+		if err := store.writeData(stored.File, contents[i], mode); err != nil {
+			return fmt.Errorf("failed to rekey %s of %s, run ccoco rekey again to finish with the key in %s: %w", stored.File, stored.Branch, pendingFile, err)
+		}
+		// Manifest hashes are keyed by the store key as well
+		if entry, ok := store.manifest.Entry(stored.File); ok {
+			entry.Hash = macData(newKey, contents[i])
+			store.manifest.Set(entry)
+			store.dirty = true
+		}
+	}
+	for _, store := range stores {
+		if err := store.Close(); err != nil {
+			return fmt.Errorf("failed to rekey the manifest of %s, run ccoco rekey again to finish with the key in %s: %w", store.branch, pendingFile, err)
+		}
+	}
+	if err := os.Rename(pendingFile, keyFile); err != nil {
+		return fmt.Errorf("failed to replace %s, every file now uses the key in %s: %w", keyFile, pendingFile, err)
+	}
+
+	c.logger.Info("Rekeyed stored files", "files", len(storedFiles), "key", keyFile)
+	return nil
+}
@@ -0,0 +1,107 @@
+package ccoco
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRekey(t *testing.T) {
+	branches := map[string][]string{"main": {".env", "certs/dev.pem"}, "develop": {".env"}}
+
+	tests := []struct {
+		name string
+		// plaintext stores the files before encryption is turned on
+		plaintext bool
+		// pending leaves the rekey interrupted after rewriting main/.env with a pending key
+		pending bool
+	}{
+		{name: "encrypted store"},
+		{name: "plaintext store", plaintext: true},
+		{name: "resumes an interrupted rekey", pending: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyFile := filepath.Join(t.TempDir(), "key")
+			t.Setenv(KeyEnv, "")
+			t.Setenv(KeyFileEnv, keyFile)
+			oldKey, err := GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteKey(keyFile, oldKey); err != nil {
+				t.Fatal(err)
+			}
+
+			c := newTestCcoco(t, &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env", "certs"}, Encrypt: !tt.plaintext})
+			storeTestFiles(t, c, branches)
+			c.configFile.Content.Encrypt = true
+
+			var pendingKey []byte
+			if tt.pending {
+				pendingKey, err = GenerateKey()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := WriteKey(keyFile+".new", pendingKey); err != nil {
+					t.Fatal(err)
+				}
+				store, err := c.openStore("main")
+				if err != nil {
+					t.Fatal(err)
+				}
+				store.key = pendingKey
+				if err := store.writeData(".env", []byte(".env"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := c.Rekey(context.Background()); err != nil {
+				t.Fatalf("Rekey() error = %v", err)
+			}
+
+			newKey, err := LoadKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(newKey, oldKey) {
+				t.Error("the key was not replaced")
+			}
+			if tt.pending && !bytes.Equal(newKey, pendingKey) {
+				t.Error("the pending key was not used")
+			}
+			if _, err := os.Stat(keyFile + ".new"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("pending key file was not removed: %v", err)
+			}
+
+			for branch, files := range branches {
+				store, err := c.openStore(branch)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, file := range files {
+					data := readTestFile(t, c.fs, c.storePath(branch, file))
+					if !isEncrypted(data) {
+						t.Errorf("%s of %s is not encrypted", file, branch)
+						continue
+					}
+					plain, err := decrypt(newKey, data)
+					if err != nil {
+						t.Errorf("%s of %s can't be decrypted with the new key: %v", file, branch, err)
+						continue
+					}
+					if string(plain) != file {
+						t.Errorf("%s of %s = %q, want %q", file, branch, plain, file)
+					}
+					if entry, _ := store.manifest.Entry(file); entry.Hash != macData(newKey, plain) {
+						t.Errorf("hash of %s of %s = %q, want the hash keyed by the new key", file, branch, entry.Hash)
+					}
+				}
+			}
+		})
+	}
+}
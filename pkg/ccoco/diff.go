@@ -0,0 +1,170 @@
+package ccoco
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// diffContext is the number of unchanged lines shown around a change
+const diffContext = 3
+
+type (
+	DiffOptions struct {
+		// Branch is the branch directory to compare with. Defaults to the config branch of the current branch.
+		Branch string
+		// Files limits the comparison to these files
+		Files []string
+	}
+	FileDiff struct {
+		File string `json:"file"`
+		// Stored reports whether the branch has a stored copy of the file
+		Stored bool `json:"stored"`
+		// Exists reports whether the file exists in the working tree
+		Exists bool `json:"exists"`
+		Binary bool `json:"binary"`
+		// Patch is the line diff from the stored copy to the working file
+		Patch string `json:"patch,omitempty"`
+	}
+)
+
+// Diff compares the stored copies of a branch with the working tree and
+// returns the files that differ
+func (c Ccoco) Diff(ctx context.Context, opts DiffOptions) ([]FileDiff, error) {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return nil, ErrNotInitialized
+	}
+
+	branch := opts.Branch
+	if branch == "" {
+		var err error
+		branch, err = c.ConfigBranch()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	store, err := c.openStore(branch)
+	if err != nil {
+		return nil, err
+	}
+	files, _, err := c.applySet(store)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Files) > 0 {
+		files = []string{}
+		for _, file := range opts.Files {
+			file = filepath.ToSlash(file)
+			if !c.isManaged(file) {
+				return nil, fmt.Errorf("%s is not in %s", file, c.configFile.Name)
+			}
+			files = append(files, file)
+		}
+	}
+
+	diffs := []FileDiff{}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		diff := FileDiff{File: file}
+
+		stored := []byte{}
+		if store.Exists(file) {
+			diff.Stored = true
+			stored, err = store.Read(file)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		working, err := readFile(c.fs, filepath.Join(c.gitClient.RootPathFromCwd, filepath.FromSlash(file)))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		diff.Exists = err == nil
+
+		if diff.Stored == diff.Exists && bytes.Equal(stored, working) {
+			continue
+		}
+		if isBinary(stored) || isBinary(working) {
+			diff.Binary = true
+		} else {
+			diff.Patch = lineDiff(branch+"/"+file, file, string(stored), string(working))
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// isBinary reports whether data looks like binary content
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// lineDiff renders a line diff from a to b, keeping diffContext unchanged lines around changes
+func lineDiff(nameA, nameB, a, b string) string {
+	dmp := diffmatchpatch.New()
+	charsA, charsB, lines := dmp.DiffLinesToChars(a, b)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(charsA, charsB, false), lines)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+	for i, diff := range diffs {
+		text := strings.TrimSuffix(diff.Text, "\n")
+		changed := strings.Split(text, "\n")
+		switch diff.Type {
+		case diffmatchpatch.DiffDelete:
+			writeLines(&out, "-", changed)
+		case diffmatchpatch.DiffInsert:
+			writeLines(&out, "+", changed)
+		default:
+			first, last := i == 0, i == len(diffs)-1
+			switch {
+			case first && last:
+			case first:
+				writeLines(&out, " ", tail(changed, diffContext))
+			case last:
+				writeLines(&out, " ", head(changed, diffContext))
+			case len(changed) > 2*diffContext:
+				writeLines(&out, " ", head(changed, diffContext))
+				out.WriteString("@@\n")
+				writeLines(&out, " ", tail(changed, diffContext))
+			default:
+				writeLines(&out, " ", changed)
+			}
+		}
+	}
+	return out.String()
+}
+
+func writeLines(out *strings.Builder, prefix string, lines []string) {
+	for _, line := range lines {
+		out.WriteString(prefix + line + "\n")
+	}
+}
+
+func head(lines []string, n int) []string {
+	if len(lines) > n {
+		return lines[:n]
+	}
+	return lines
+}
+
+func tail(lines []string, n int) []string {
+	if len(lines) > n {
+		return lines[len(lines)-n:]
+	}
+	return lines
+}
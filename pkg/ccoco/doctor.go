@@ -0,0 +1,623 @@
+package ccoco
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// Statuses of a DoctorCheck
+const (
+	CheckOK      = "ok"
+	CheckWarning = "warning"
+	CheckError   = "error"
+	CheckNotice  = "notice"
+	CheckFixed   = "fixed"
+	CheckSkipped = "skipped"
+)
+
+type (
+	DoctorOptions struct {
+		// Fix repairs the problems that can be repaired
+		Fix bool
+	}
+	DoctorReport struct {
+		Healthy bool          `json:"healthy"`
+		Checks  []DoctorCheck `json:"checks"`
+	}
+	DoctorCheck struct {
+		Name    string `json:"name"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		// Fixable reports whether doctor --fix can repair the problem
+		Fixable bool `json:"fixable,omitempty"`
+	}
+)
+
+// Problems returns the checks that neither passed nor were fixed. Notices are
+// reported without making the setup unhealthy.
+func (r *DoctorReport) Problems() []DoctorCheck {
+	problems := []DoctorCheck{}
+	for _, check := range r.Checks {
+		if check.Status == CheckWarning || check.Status == CheckError {
+			problems = append(problems, check)
+		}
+	}
+	return problems
+}
+
+// doctorCheck inspects one aspect of the setup, repairing it when fix is set
+type doctorCheck func(ctx context.Context, c Ccoco, fix bool) []DoctorCheck
+
+// storeChecks need an initialized project with a valid config file
+var storeChecks = []doctorCheck{
+	checkStoredFiles,
+	checkPermissions,
+	checkRenames,
+	checkOrphans,
+}
+
+// Doctor checks the setup of ccoco and optionally repairs it. It also works
+// on instances created with NewUnloaded when the config file can't be read.
+func (c Ccoco) Doctor(ctx context.Context, opts DoctorOptions) (*DoctorReport, error) {
+	report := &DoctorReport{Checks: []DoctorCheck{}}
+
+	initChecks := checkInit(c, opts.Fix)
+	configChecks := checkConfig(c)
+	report.Checks = append(report.Checks, initChecks...)
+	report.Checks = append(report.Checks, configChecks...)
+	report.Checks = append(report.Checks, checkGitIgnore(c, opts.Fix)...)
+	report.Checks = append(report.Checks, checkHooks(ctx, c, opts.Fix)...)
+
+	ready := true
+	for _, check := range append(initChecks, configChecks...) {
+		if check.Status == CheckError || (check.Status == CheckWarning && check.Fixable) {
+			ready = false
+		}
+	}
+	for _, check := range storeChecks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !ready {
+			report.Checks = append(report.Checks, DoctorCheck{Name: "store", Status: CheckSkipped, Message: "fix the setup and config problems first"})
+			break
+		}
+		report.Checks = append(report.Checks, check(ctx, c, opts.Fix)...)
+	}
+
+	report.Healthy = len(report.Problems()) == 0
+	return report, nil
+}
+
+// fixed runs fix and turns check into a fixed or failed check
+func fixed(check DoctorCheck, message string, fix func() error) DoctorCheck {
+	if err := fix(); err != nil {
+		check.Status = CheckError
+		check.Message = fmt.Sprintf("%s, failed to fix it: %v", check.Message, err)
+		return check
+	}
+	check.Status = CheckFixed
+	check.Message = message
+	return check
+}
+
+// checkInit checks every piece of IsInitialized on its own
+func checkInit(c Ccoco, fix bool) []DoctorCheck {
+	checks := []DoctorCheck{}
+	for _, dir := range []string{c.directories.Root, c.directories.Configs, c.directories.Preflights} {
+		path := filepath.Join(c.gitClient.RootPathFromCwd, dir)
+		info, err := c.fs.Stat(path)
+		switch {
+		case err == nil && info.IsDir():
+			checks = append(checks, DoctorCheck{Name: "init", Status: CheckOK, Message: dir + " exists"})
+		case err == nil:
+			checks = append(checks, DoctorCheck{Name: "init", Status: CheckError, Message: dir + " is not a directory"})
+		default:
+			check := DoctorCheck{Name: "init", Status: CheckWarning, Message: dir + " is missing", Fixable: true}
+			if fix {
+				check = fixed(check, "created "+dir, func() error {
+					return c.fs.MkdirAll(path, 0755)
+				})
+			}
+			checks = append(checks, check)
+		}
+	}
+
+	if _, err := c.fs.Stat(filepath.Join(c.gitClient.RootPathFromCwd, c.configFile.Name)); err != nil {
+		checks = append(checks, DoctorCheck{Name: "init", Status: CheckError, Message: c.configFile.Name + " is missing, run ccoco init"})
+	} else {
+		checks = append(checks, DoctorCheck{Name: "init", Status: CheckOK, Message: c.configFile.Name + " exists"})
+	}
+	return checks
+}
+
+// checkConfig validates the config file as it is on disk
+func checkConfig(c Ccoco) []DoctorCheck {
+	const name = "config"
+	data, err := readFile(c.fs, filepath.Join(c.gitClient.RootPathFromCwd, c.configFile.Name))
+	if err != nil {
+		return []DoctorCheck{{Name: name, Status: CheckSkipped, Message: "no config file to check"}}
+	}
+
+	content := &FileContent{}
+	if err := json.Unmarshal(data, content); err != nil {
+		return []DoctorCheck{{Name: name, Status: CheckError, Message: fmt.Sprintf("%s is not valid JSON: %v", c.configFile.Name, err)}}
+	}
+	if err := content.CheckState(); err != nil {
+		return []DoctorCheck{{Name: name, Status: CheckError, Message: fmt.Sprintf("%s is invalid: %v", c.configFile.Name, err)}}
+	}
+
+	// Unknown keys are usually typos of an option that is silently ignored
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&FileContent{}); err != nil {
+		return []DoctorCheck{{Name: name, Status: CheckWarning, Message: fmt.Sprintf("%s: %v", c.configFile.Name, err)}}
+	}
+	return []DoctorCheck{{Name: name, Status: CheckOK, Message: c.configFile.Name + " is valid"}}
+}
+
+// checkGitIgnore checks that git ignores the ccoco directory
+func checkGitIgnore(c Ccoco, fix bool) []DoctorCheck {
+	const name = "gitignore"
+	patterns, err := gitignore.ReadPatterns(c.gitClient.Worktree.Filesystem, nil)
+	if err != nil {
+		return []DoctorCheck{{Name: name, Status: CheckError, Message: fmt.Sprintf("failed to read .gitignore: %v", err)}}
+	}
+	if gitignore.NewMatcher(patterns).Match(strings.Split(filepath.ToSlash(c.directories.Root), "/"), true) {
+		return []DoctorCheck{{Name: name, Status: CheckOK, Message: c.directories.Root + " is ignored"}}
+	}
+
+	check := DoctorCheck{Name: name, Status: CheckWarning, Message: c.directories.Root + " is not ignored and could be committed", Fixable: true}
+	if fix {
+		check = fixed(check, "added "+c.directories.Root+" to .gitignore", c.AddToGitIgnore)
+	}
+	return []DoctorCheck{check}
+}
+
+// checkHooks checks that the injected hooks are executable and run an existing ccoco binary
+func checkHooks(ctx context.Context, c Ccoco, fix bool) []DoctorCheck {
+	const name = "hooks"
+	checks := []DoctorCheck{}
+	for _, hook := range []string{HookPostCheckout, HookPreCommit} {
+		command := "run"
+		if hook == HookPreCommit {
+			command = "guard"
+		}
+		inject := func() error {
+			return c.AddToGitHooks(ctx, AddToGitHooksOptions{SkipExecution: true, Hooks: []string{hook}})
+		}
+
+		path := filepath.Join(c.gitClient.RootPathFromCwd, ".git", "hooks", hook)
+		info, err := c.fs.Stat(path)
+		if err != nil {
+			if hook == HookPreCommit {
+				checks = append(checks, DoctorCheck{Name: name, Status: CheckOK, Message: hook + " hook is not installed"})
+				continue
+			}
+			check := DoctorCheck{Name: name, Status: CheckWarning, Message: hook + " hook is not installed, configs are only applied by ccoco run", Fixable: true}
+			if fix {
+				check = fixed(check, "installed the "+hook+" hook", inject)
+			}
+			checks = append(checks, check)
+			continue
+		}
+
+		executable, ok, err := hookExecutable(c.fs, path, command)
+		if err != nil {
+			checks = append(checks, DoctorCheck{Name: name, Status: CheckError, Message: fmt.Sprintf("failed to read the %s hook: %v", hook, err)})
+			continue
+		}
+		if !ok {
+			// Other pre-commit hooks, e.g. of husky or lefthook, are fine without the guard
+			if hook == HookPreCommit {
+				checks = append(checks, DoctorCheck{Name: name, Status: CheckNotice, Message: hook + " hook doesn't run ccoco guard, add ccoco guard to it to block commits of branch configs"})
+				continue
+			}
+			checks = append(checks, DoctorCheck{Name: name, Status: CheckWarning, Message: hook + " hook doesn't run ccoco"})
+			continue
+		}
+		if !hookBinaryExists(c.gitClient.RootPathFromCwd, executable) {
+			check := DoctorCheck{Name: name, Status: CheckError, Message: fmt.Sprintf("%s hook runs %s which doesn't exist", hook, executable), Fixable: true}
+			if fix {
+				check = fixed(check, "pointed the "+hook+" hook to this ccoco binary", inject)
+			}
+			checks = append(checks, check)
+			continue
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0 {
+			check := DoctorCheck{Name: name, Status: CheckWarning, Message: hook + " hook is not executable", Fixable: true}
+			if fix {
+				check = fixed(check, "made the "+hook+" hook executable", func() error {
+					return chmod(c.fs, path, info.Mode().Perm()|0755)
+				})
+			}
+			checks = append(checks, check)
+			continue
+		}
+		checks = append(checks, DoctorCheck{Name: name, Status: CheckOK, Message: fmt.Sprintf("%s hook runs %s", hook, executable)})
+	}
+	return checks
+}
+
+// hookExecutable returns the executable of the line of a hook script running
+// command, which may be followed by flags, e.g. ccoco run --quiet
+func hookExecutable(fsys billy.Filesystem, path, command string) (string, bool, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || fields[1] != command || !strings.Contains(fields[0], "ccoco") {
+			continue
+		}
+		return fields[0], true, nil
+	}
+	return "", false, scanner.Err()
+}
+
+// hookBinaryExists reports whether a hook run from the repository root finds executable
+func hookBinaryExists(root, executable string) bool {
+	if !strings.ContainsAny(executable, `/\`) {
+		_, err := exec.LookPath(executable)
+		return err == nil
+	}
+	if !filepath.IsAbs(executable) {
+		executable = filepath.Join(root, executable)
+	}
+	info, err := os.Stat(executable)
+	return err == nil && !info.IsDir()
+}
+
+// checkStoredFiles reads every stored file and compares it with its manifest entry
+func checkStoredFiles(ctx context.Context, c Ccoco, fix bool) []DoctorCheck {
+	const name = "stored-files"
+	storedFiles, err := c.listStoredFiles()
+	if err != nil {
+		return []DoctorCheck{{Name: name, Status: CheckError, Message: fmt.Sprintf("failed to list stored files: %v", err)}}
+	}
+
+	checks := []DoctorCheck{}
+	stores := map[string]*branchStore{}
+	for _, stored := range storedFiles {
+		store, ok := stores[stored.Branch]
+		if !ok {
+			store, err = c.openStore(stored.Branch)
+			if err != nil {
+				checks = append(checks, DoctorCheck{Name: name, Status: CheckError, Message: err.Error()})
+				continue
+			}
+			stores[stored.Branch] = store
+		}
+		label := stored.Branch + "/" + stored.File
+
+		data, err := store.Read(stored.File)
+		if errors.Is(err, os.ErrNotExist) {
+			check := DoctorCheck{Name: name, Status: CheckError, Message: label + " is listed in the manifest but missing", Fixable: true}
+			if fix {
+				check = fixed(check, "removed the missing "+label+" from the manifest", func() error {
+					store.manifest.Remove(stored.File)
+					store.dirty = true
+					return nil
+				})
+			}
+			checks = append(checks, check)
+			continue
+		}
+		if err != nil {
+			checks = append(checks, DoctorCheck{Name: name, Status: CheckError, Message: fmt.Sprintf("%s can't be read: %v", label, err)})
+			continue
+		}
+
+		hash, err := store.hash(data)
+		if err != nil {
+			checks = append(checks, DoctorCheck{Name: name, Status: CheckError, Message: fmt.Sprintf("%s can't be hashed: %v", label, err)})
+			continue
+		}
+		// Symlinked files are edited in place through the working tree, so their hash is expected to drift
+		symlinked := c.configFile.Content.OptionsFor(stored.File).ApplyMode() == ApplySymlink
+		if entry, ok := store.manifest.Entry(stored.File); ok && entry.Hash != hash && !symlinked {
+			check := DoctorCheck{Name: name, Status: CheckWarning, Message: label + " was changed outside of ccoco, its manifest hash is outdated", Fixable: true}
+			if c.configFile.Content.Encrypt && strings.HasPrefix(entry.Hash, "sha256:") {
+				check.Message = label + " is encrypted, but its manifest records the plain hash of its content"
+			}
+			if fix {
+				check = fixed(check, "updated the manifest hash of "+label, func() error {
+					entry.Hash = hash
+					entry.UpdatedAt = c.now().UTC()
+					store.manifest.Set(entry)
+					store.dirty = true
+					return nil
+				})
+			}
+			checks = append(checks, check)
+		}
+	}
+
+	checks = append(checks, checkUnlistedFiles(c, fix, stores)...)
+	for _, store := range stores {
+		if err := store.Close(); err != nil {
+			checks = append(checks, DoctorCheck{Name: name, Status: CheckError, Message: fmt.Sprintf("failed to write the manifest of %s: %v", store.branch, err)})
+		}
+	}
+	if len(checks) == 0 {
+		checks = append(checks, DoctorCheck{Name: name, Status: CheckOK, Message: fmt.Sprintf("%d stored file(s) are readable", len(storedFiles))})
+	}
+	return checks
+}
+
+// checkUnlistedFiles finds files in the configs directory that ccoco doesn't know about:
+// files without a header in older formats, or files missing from their manifest
+func checkUnlistedFiles(c Ccoco, fix bool, stores map[string]*branchStore) []DoctorCheck {
+	const name = "stored-files"
+	configsPath := c.configsPath()
+	format := c.configFile.Content.Format()
+
+	checks := []DoctorCheck{}
+	err := walkDir(c.fs, configsPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(configsPath, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.Name() == ManifestFileName && !inFilesDir(rel) {
+			return nil
+		}
+
+		if format < StoreFormatManifest {
+			if _, ok, err := readHeader(c.fs, path); err != nil || !ok {
+				checks = append(checks, DoctorCheck{Name: name, Status: CheckWarning, Message: "malformed config file " + rel + " has no header and is ignored"})
+			}
+			return nil
+		}
+
+		// Stored files live in the files directory of their branch directory
+		branch, file, ok := strings.Cut(rel, "/"+StoreFilesDir+"/")
+		if !ok {
+			checks = append(checks, DoctorCheck{Name: name, Status: CheckWarning, Message: rel + " is not in the files directory of any branch and is ignored"})
+			return nil
+		}
+		if _, err := c.fs.Stat(filepath.Join(c.branchPath(branch), ManifestFileName)); err != nil {
+			checks = append(checks, DoctorCheck{Name: name, Status: CheckWarning, Message: rel + " is not in any branch directory with a manifest"})
+			return nil
+		}
+		store, ok := stores[branch]
+		if !ok {
+			store, err = c.openStore(branch)
+			if err != nil {
+				return err
+			}
+			stores[branch] = store
+		}
+		if _, ok := store.manifest.Entry(file); ok {
+			return nil
+		}
+
+		check := DoctorCheck{Name: name, Status: CheckWarning, Message: rel + " is not listed in the manifest of " + branch + " and is ignored", Fixable: true}
+		if fix {
+			check = fixed(check, "added "+rel+" to the manifest of "+branch, func() error {
+				data, err := store.Read(file)
+				if err != nil {
+					return err
+				}
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				hash, err := store.hash(data)
+				if err != nil {
+					return err
+				}
+				store.manifest.Set(newManifestEntry(file, hash, info.Mode(), SourceDoctor, c.now()))
+				store.dirty = true
+				return nil
+			})
+		}
+		checks = append(checks, check)
+		return nil
+	})
+	if err != nil {
+		checks = append(checks, DoctorCheck{Name: name, Status: CheckError, Message: fmt.Sprintf("failed to walk %s: %v", configsPath, err)})
+	}
+	return checks
+}
+
+// checkPermissions finds keys readable by other users, stored files more open than
+// their target and, for encrypted stores, stored and working files readable by other users
+func checkPermissions(ctx context.Context, c Ccoco, fix bool) []DoctorCheck {
+	const name = "permissions"
+	if runtime.GOOS == "windows" {
+		return []DoctorCheck{{Name: name, Status: CheckSkipped, Message: "file permissions are not checked on Windows"}}
+	}
+
+	checks := []DoctorCheck{}
+	if keyFile, err := DefaultKeyFile(); err == nil {
+		if info, err := os.Stat(keyFile); err == nil && info.Mode().Perm()&0077 != 0 {
+			check := DoctorCheck{Name: name, Status: CheckError, Message: fmt.Sprintf("key file %s is readable by other users", keyFile), Fixable: true}
+			// The key file is kept outside of the filesystem of the instance
+			if fix && !c.dryRun {
+				check = fixed(check, "restricted "+keyFile+" to 0600", func() error {
+					return os.Chmod(keyFile, 0600)
+				})
+			}
+			checks = append(checks, check)
+		}
+	}
+
+	storedFiles, err := c.listStoredFiles()
+	if err != nil {
+		return append(checks, DoctorCheck{Name: name, Status: CheckError, Message: fmt.Sprintf("failed to list stored files: %v", err)})
+	}
+	stores := map[string]*branchStore{}
+	for _, stored := range storedFiles {
+		store, ok := stores[stored.Branch]
+		if !ok {
+			store, err = c.openStore(stored.Branch)
+			if err != nil {
+				continue
+			}
+			stores[stored.Branch] = store
+		}
+
+		// A stored copy must not be more open than the file it is applied to
+		mode, ok := store.Mode(stored.File)
+		overrideMode, hasOverride, err := c.configFile.Content.OptionsFor(stored.File).FileMode()
+		if err == nil && hasOverride {
+			mode, ok = overrideMode, true
+		}
+		if !ok {
+			continue
+		}
+		path := c.storePath(stored.Branch, stored.File)
+		info, err := c.fs.Stat(path)
+		if err != nil {
+			continue
+		}
+		label := stored.Branch + "/" + stored.File
+
+		// Encrypted configs are secrets and applied for the current user only,
+		// unless a mode is configured on purpose
+		if open := mode.Perm() & 0077; open != 0 && !hasOverride && c.configFile.Content.Encrypt {
+			private := mode.Perm() &^ open
+			check := DoctorCheck{Name: name, Status: CheckWarning, Message: fmt.Sprintf("%s is applied as %s, readable by other users", label, formatMode(mode)), Fixable: true}
+			if fix {
+				check = fixed(check, "restricted "+label+" to "+formatMode(private), func() error {
+					if entry, ok := store.manifest.Entry(stored.File); ok {
+						entry.Mode = formatMode(private)
+						store.manifest.Set(entry)
+						store.dirty = true
+					}
+					return chmod(c.fs, path, info.Mode().Perm()&^0077)
+				})
+			}
+			checks = append(checks, check)
+			continue
+		}
+
+		if extra := info.Mode().Perm() &^ mode.Perm() & 0077; extra != 0 {
+			check := DoctorCheck{Name: name, Status: CheckWarning, Message: fmt.Sprintf("%s is stored as %s but applied as %s", label, formatMode(info.Mode()), formatMode(mode)), Fixable: true}
+			if fix {
+				check = fixed(check, "restricted "+label+" to "+formatMode(info.Mode()&^extra), func() error {
+					return chmod(c.fs, path, info.Mode().Perm()&^extra)
+				})
+			}
+			checks = append(checks, check)
+		}
+	}
+	for _, store := range stores {
+		if err := store.Close(); err != nil {
+			checks = append(checks, DoctorCheck{Name: name, Status: CheckError, Message: fmt.Sprintf("failed to write the manifest of %s: %v", store.branch, err)})
+		}
+	}
+
+	// The applied files in the working tree
+	seen := map[string]struct{}{}
+	for _, stored := range storedFiles {
+		if _, ok := seen[stored.File]; ok {
+			continue
+		}
+		seen[stored.File] = struct{}{}
+		if _, hasOverride, err := c.configFile.Content.OptionsFor(stored.File).FileMode(); err != nil || hasOverride {
+			continue
+		}
+		path := filepath.Join(c.gitClient.RootPathFromCwd, stored.File)
+		info, err := c.fs.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if open := info.Mode().Perm() & 0077; open != 0 && c.configFile.Content.Encrypt {
+			check := DoctorCheck{Name: name, Status: CheckWarning, Message: fmt.Sprintf("%s is %s, readable by other users", stored.File, formatMode(info.Mode())), Fixable: true}
+			if fix {
+				check = fixed(check, "restricted "+stored.File+" to "+formatMode(info.Mode()&^open), func() error {
+					return chmod(c.fs, path, info.Mode().Perm()&^open)
+				})
+			}
+			checks = append(checks, check)
+		}
+	}
+
+	if len(checks) == 0 {
+		checks = append(checks, DoctorCheck{Name: name, Status: CheckOK, Message: "no file is readable by more users than intended"})
+	}
+	return checks
+}
+
+// checkRenames finds configs left behind by renamed branches
+func checkRenames(ctx context.Context, c Ccoco, fix bool) []DoctorCheck {
+	const name = "branch-renames"
+	pending, err := c.PendingRenames()
+	if err != nil {
+		return []DoctorCheck{{Name: name, Status: CheckError, Message: fmt.Sprintf("failed to read the reflog: %v", err)}}
+	}
+	if len(pending) == 0 {
+		return []DoctorCheck{{Name: name, Status: CheckOK, Message: "no configs left behind by renamed branches"}}
+	}
+
+	checks := []DoctorCheck{}
+	for _, rename := range pending {
+		check := DoctorCheck{
+			Name:    name,
+			Status:  CheckWarning,
+			Message: fmt.Sprintf("%s was renamed to %s but its configs are still stored under %s", rename.From, rename.To, rename.From),
+			Fixable: true,
+		}
+		if fix {
+			check = fixed(check, fmt.Sprintf("moved the configs of %s to %s", rename.From, rename.To), func() error {
+				return c.RenameConfigs(ctx, rename.From, rename.To)
+			})
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// checkOrphans finds the configs of deleted branches
+func checkOrphans(ctx context.Context, c Ccoco, fix bool) []DoctorCheck {
+	const name = "orphaned-configs"
+	stale, err := c.Prune(ctx, PruneOptions{DryRun: true, Remotes: true})
+	if err != nil {
+		return []DoctorCheck{{Name: name, Status: CheckError, Message: fmt.Sprintf("failed to find orphaned configs: %v", err)}}
+	}
+	if len(stale) == 0 {
+		return []DoctorCheck{{Name: name, Status: CheckOK, Message: "every branch directory belongs to a branch"}}
+	}
+
+	checks := []DoctorCheck{}
+	for _, branch := range stale {
+		checks = append(checks, DoctorCheck{
+			Name:    name,
+			Status:  CheckWarning,
+			Message: fmt.Sprintf("%s has no branch anymore (%d file(s), last modified %s), run ccoco prune", branch.Branch, branch.Files, branch.ModTime.Format(time.DateTime)),
+		})
+	}
+	return checks
+}
@@ -0,0 +1,83 @@
+package ccoco
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not checked on Windows")
+	}
+
+	tests := []struct {
+		name    string
+		encrypt bool
+		want    string
+	}{
+		{name: "plaintext store", want: CheckOK},
+		{name: "encrypted store", encrypt: true, want: CheckWarning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyFile := filepath.Join(t.TempDir(), "key")
+			t.Setenv(KeyEnv, "")
+			t.Setenv(KeyFileEnv, keyFile)
+			key, err := GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteKey(keyFile, key); err != nil {
+				t.Fatal(err)
+			}
+
+			c := newTestCcoco(t, &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env"}, Encrypt: tt.encrypt})
+			// .env is applied readable by everyone, as saved from a 0644 file
+			store, err := c.openStore("main")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Write(".env", []byte(".env"), 0644, ""); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			checks := checkPermissions(context.Background(), *c, false)
+			if len(checks) != 1 || checks[0].Status != tt.want {
+				t.Errorf("checkPermissions() = %v, want one %s check", checks, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHooksForeignPreCommit(t *testing.T) {
+	c := newTestCcoco(t, &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env"}})
+	path := filepath.Join(c.gitClient.RootPathFromCwd, ".git", "hooks", HookPreCommit)
+	if err := c.fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(c.fs, path, []byte("#!/bin/sh\nnpx lint-staged\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A pre-commit hook of another tool only lacks the guard
+	found := false
+	for _, check := range checkHooks(context.Background(), *c, false) {
+		if !strings.HasPrefix(check.Message, HookPreCommit) {
+			continue
+		}
+		found = true
+		if check.Status != CheckNotice {
+			t.Errorf("%s check = %s: %s, want %s", HookPreCommit, check.Status, check.Message, CheckNotice)
+		}
+	}
+	if !found {
+		t.Errorf("no %s check", HookPreCommit)
+	}
+}
@@ -0,0 +1,25 @@
+package ccoco
+
+import "errors"
+
+// Sentinel errors, test for them with errors.Is
+var (
+	// ErrNotInitialized is returned when the ccoco directories or config file are missing
+	ErrNotInitialized = errors.New("ccoco is not initialized properly. please reinitialize it")
+	// ErrNoConfig is returned when a branch has no configs to apply
+	ErrNoConfig = errors.New("no configs found")
+	// ErrMalformedStore is returned when stored files or manifests can't be read
+	ErrMalformedStore = errors.New("malformed config store")
+	// ErrHookConflict is returned when a git hook not written by ccoco would be replaced
+	ErrHookConflict = errors.New("git hook was not written by ccoco")
+	// ErrDirtyFile is returned when files with local changes would be lost or committed
+	ErrDirtyFile = errors.New("file has local changes")
+	// ErrPlaintextStore is returned when a store that isn't fully encrypted would be pushed
+	ErrPlaintextStore = errors.New("the store is not encrypted")
+	// ErrRenameFailed is returned when Run can't move the configs of a renamed branch
+	ErrRenameFailed = errors.New("failed to move the configs of the renamed branch")
+	// ErrSeedFailed is returned when Run can't seed the configs of a new branch
+	ErrSeedFailed = errors.New("failed to seed the configs of the new branch")
+	// ErrDryRun is returned by operations that write to git in a dry run
+	ErrDryRun = errors.New("not supported in a dry run")
+)
@@ -1,6 +1,14 @@
 package ccoco
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 type (
 	File struct {
@@ -8,10 +16,43 @@ type (
 		Content *FileContent
 	}
 	FileContent struct {
-		Files []string `json:"files"`
+		StoreFormat int                    `json:"storeFormat,omitempty"`
+		Encrypt     bool                   `json:"encrypt,omitempty"`
+		Store       *StoreSource           `json:"store,omitempty"`
+		Base        string                 `json:"base,omitempty"`
+		Files       []string               `json:"files"`
+		Defaults    *FileOptions           `json:"defaults,omitempty"`
+		Options     map[string]FileOptions `json:"options,omitempty"`
+	}
+	// FileOptions overrides how a single entry of Files is handled
+	FileOptions struct {
+		// Mode is the octal permission applied to the file, e.g. "0600"
+		Mode string `json:"mode,omitempty"`
+		// Apply is how the stored file is applied, either ApplyCopy or ApplySymlink
+		Apply string `json:"apply,omitempty"`
+		// OnMissing is what happens to the file when a branch has no stored copy of it
+		OnMissing string `json:"onMissing,omitempty"`
 	}
 )
 
+// Policies of FileOptions.OnMissing
+const (
+	// OnMissingKeep leaves the current file as it is
+	OnMissingKeep = "keep"
+	// OnMissingDelete removes the current file
+	OnMissingDelete = "delete"
+	// OnMissingRestore restores the version of the file in HEAD, removing it when it isn't tracked
+	OnMissingRestore = "restore"
+	// OnMissingFail aborts the run without touching any file
+	OnMissingFail = "fail"
+)
+
+// Apply modes of FileOptions
+const (
+	ApplyCopy    = "copy"
+	ApplySymlink = "symlink"
+)
+
 func (f *File) CheckState() error {
 	if f.Name == "" {
 		return errors.New("file name is empty")
@@ -29,5 +70,141 @@ func (fc *FileContent) CheckState() error {
 	if len(fc.Files) == 0 {
 		return errors.New("file content is empty")
 	}
+	if fc.StoreFormat < 0 || fc.StoreFormat > LatestStoreFormat {
+		return fmt.Errorf("unknown store format %d", fc.StoreFormat)
+	}
+	if fc.Encrypt && fc.Format() < StoreFormatManifest {
+		return fmt.Errorf("encryption requires store format %d, run ccoco migrate", StoreFormatManifest)
+	}
+	if fc.Base != "" {
+		clean := path.Clean(fc.Base)
+		if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("base %s is outside of the store", fc.Base)
+		}
+	}
+	if fc.Store != nil {
+		if err := fc.Store.CheckState(); err != nil {
+			return fmt.Errorf("invalid store: %w", err)
+		}
+	}
+	for _, file := range fc.Files {
+		if !isPattern(file) {
+			continue
+		}
+		if fc.Format() < StoreFormatManifest {
+			return fmt.Errorf("pattern %s requires store format %d, run ccoco migrate", file, StoreFormatManifest)
+		}
+		if err := checkPattern(file); err != nil {
+			return fmt.Errorf("invalid pattern %s: %w", file, err)
+		}
+	}
+	for _, file := range fc.Files {
+		// Files are applied inside the repository, and mirrored stores reuse the path as-is
+		clean := path.Clean(file)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("file %s is outside of the repository", file)
+		}
+	}
+	if fc.Defaults != nil {
+		if err := fc.Defaults.CheckState(); err != nil {
+			return fmt.Errorf("invalid default options: %w", err)
+		}
+	}
+	for file, options := range fc.Options {
+		if err := options.CheckState(); err != nil {
+			return fmt.Errorf("invalid options for %s: %w", file, err)
+		}
+	}
 	return nil
 }
+
+func (fo FileOptions) CheckState() error {
+	if _, _, err := fo.FileMode(); err != nil {
+		return err
+	}
+	switch fo.Apply {
+	case "", ApplyCopy, ApplySymlink:
+	default:
+		return fmt.Errorf("unknown apply mode %q", fo.Apply)
+	}
+	switch fo.OnMissing {
+	case "", OnMissingKeep, OnMissingDelete, OnMissingRestore, OnMissingFail:
+	default:
+		return fmt.Errorf("unknown onMissing policy %q", fo.OnMissing)
+	}
+	return nil
+}
+
+// FileMode returns the parsed mode override. It reports false when no mode is set.
+func (fo FileOptions) FileMode() (os.FileMode, bool, error) {
+	if fo.Mode == "" {
+		return 0, false, nil
+	}
+	mode, err := strconv.ParseUint(fo.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, false, fmt.Errorf("invalid mode %q", fo.Mode)
+	}
+	return os.FileMode(mode), true, nil
+}
+
+// ApplyMode returns the apply mode, defaulting to ApplyCopy
+func (fo FileOptions) ApplyMode() string {
+	if fo.Apply == "" {
+		return ApplyCopy
+	}
+	return fo.Apply
+}
+
+// OnMissingPolicy returns the OnMissing policy, defaulting to OnMissingKeep
+func (fo FileOptions) OnMissingPolicy() string {
+	if fo.OnMissing == "" {
+		return OnMissingKeep
+	}
+	return fo.OnMissing
+}
+
+// merge returns fo with every option set in other taking precedence
+func (fo FileOptions) merge(other FileOptions) FileOptions {
+	if other.Mode != "" {
+		fo.Mode = other.Mode
+	}
+	if other.Apply != "" {
+		fo.Apply = other.Apply
+	}
+	if other.OnMissing != "" {
+		fo.OnMissing = other.OnMissing
+	}
+	return fo
+}
+
+// OptionsFor returns the options of file, with its own options taking precedence over the defaults.
+// Files without options of their own use the options of the first pattern or directory they match.
+func (fc *FileContent) OptionsFor(file string) FileOptions {
+	defaults := FileOptions{}
+	if fc.Defaults != nil {
+		defaults = *fc.Defaults
+	}
+	if options, exists := fc.Options[file]; exists {
+		return defaults.merge(options)
+	}
+	entries := make([]string, 0, len(fc.Options))
+	for entry := range fc.Options {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	for _, entry := range entries {
+		if matchEntry(entry, file) {
+			return defaults.merge(fc.Options[entry])
+		}
+	}
+	return defaults
+}
+
+// Format returns the store format of the config file. Config files written
+// before the format was recorded use StoreFormatFlat.
+func (fc *FileContent) Format() int {
+	if fc.StoreFormat == 0 {
+		return StoreFormatFlat
+	}
+	return fc.StoreFormat
+}
@@ -0,0 +1,124 @@
+package ccoco
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/helper/chroot"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
+)
+
+// osFilesystem is the filesystem of the operating system. Relative paths are
+// resolved against the current directory, like the os package does.
+type osFilesystem struct {
+	*osfs.ChrootOS
+}
+
+func newOSFilesystem() billy.Filesystem {
+	return osFilesystem{osfs.Default}
+}
+
+func (osFilesystem) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (fsys osFilesystem) Chroot(path string) (billy.Filesystem, error) {
+	return chroot.New(fsys, path), nil
+}
+
+func (osFilesystem) Root() string {
+	return "."
+}
+
+func (osFilesystem) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (osFilesystem) Lchown(name string, uid, gid int) error {
+	return os.Lchown(name, uid, gid)
+}
+
+func (osFilesystem) Chown(name string, uid, gid int) error {
+	return os.Chown(name, uid, gid)
+}
+
+func (osFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (osFilesystem) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+// linker is implemented by filesystems supporting hard links
+type linker interface {
+	Link(oldname, newname string) error
+}
+
+// errNoLink is returned by link when the filesystem has no hard links
+var errNoLink = errors.New("hard links are not supported")
+
+// link creates newname as a hard link to oldname
+func link(fsys billy.Filesystem, oldname, newname string) error {
+	l, ok := fsys.(linker)
+	if !ok {
+		return errNoLink
+	}
+	return l.Link(oldname, newname)
+}
+
+// readFile reads the named file from fsys
+func readFile(fsys billy.Filesystem, name string) ([]byte, error) {
+	return util.ReadFile(fsys, name)
+}
+
+// writeFile writes data to the named file in fsys, creating it with perm when
+// it doesn't exist, like os.WriteFile
+func writeFile(fsys billy.Filesystem, name string, data []byte, perm os.FileMode) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncFile commits the content of f to storage when the filesystem supports it
+func syncFile(f billy.File) error {
+	if s, ok := f.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// chmod changes the mode of the named file. Filesystems without modes keep
+// the mode files were created with.
+func chmod(fsys billy.Filesystem, name string, mode os.FileMode) error {
+	if change, ok := fsys.(billy.Change); ok {
+		return change.Chmod(name, mode)
+	}
+	return nil
+}
+
+// removeAll removes path and any children it contains
+func removeAll(fsys billy.Filesystem, path string) error {
+	return util.RemoveAll(fsys, path)
+}
+
+// walkDir walks the file tree rooted at root like filepath.WalkDir, without following symbolic links
+func walkDir(fsys billy.Filesystem, root string, fn fs.WalkDirFunc) error {
+	return util.Walk(fsys, root, func(path string, info os.FileInfo, err error) error {
+		var d fs.DirEntry
+		if info != nil {
+			d = fs.FileInfoToDirEntry(info)
+		}
+		return fn(path, d, err)
+	})
+}
@@ -1,12 +1,25 @@
 package ccoco
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"errors"
-	"log"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
 )
 
 type Git struct {
@@ -18,35 +31,30 @@ type Git struct {
 func NewGitClient(path string) (*Git, error) {
 	repository, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
 	if err != nil {
-		log.Printf("Error opening repository: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("error opening repository: %w", err)
 	}
 
 	// Get the worktree of the repository
 	worktree, err := repository.Worktree()
 	if err != nil {
-		log.Printf("Error getting worktree: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("error getting worktree: %w", err)
 	}
 
 	// Check if worktree exists
 	if worktree == nil {
-		log.Println("No worktree found.")
 		return nil, errors.New("error getting worktree: No worktree found")
 	}
 
 	// Get current directory
 	cwd, err := os.Getwd()
 	if err != nil {
-		log.Printf("Error getting current directory: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("error getting current directory: %w", err)
 	}
 
 	// Get the relative path from the current directory to the git worktree root
 	rootPathFromCwd, err := filepath.Rel(cwd, worktree.Filesystem.Root())
 	if err != nil {
-		log.Printf("Error getting relative path: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("error getting relative path: %w", err)
 	}
 
 	return &Git{
@@ -55,6 +63,20 @@ func NewGitClient(path string) (*Git, error) {
 		RootPathFromCwd: rootPathFromCwd}, nil
 }
 
+// NewGitClientFromRepository wraps an already opened repository, e.g. one kept
+// in memory. Its worktree root is taken as the current directory.
+func NewGitClientFromRepository(repository *git.Repository) (*Git, error) {
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("error getting worktree: %w", err)
+	}
+
+	return &Git{
+		Repository:      repository,
+		Worktree:        worktree,
+		RootPathFromCwd: "."}, nil
+}
+
 func (g *Git) CheckState() error {
 	if g.Repository == nil {
 		return errors.New("repository is nil")
@@ -67,3 +89,340 @@ func (g *Git) CheckState() error {
 	}
 	return nil
 }
+
+// CurrentBranch returns the short name of the checked out branch
+func (g *Git) CurrentBranch() (string, error) {
+	head, err := g.Repository.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		// An unborn branch has no commit yet, but HEAD already names it
+		symbolic, symbolicErr := g.Repository.Storer.Reference(plumbing.HEAD)
+		if symbolicErr == nil && symbolic.Type() == plumbing.SymbolicReference {
+			return symbolic.Target().Short(), nil
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return head.Name().Short(), nil
+}
+
+// headTreeFile returns file from the tree of the HEAD commit. It returns nil when file is not tracked.
+func (g *Git) headTreeFile(file string) (*object.File, error) {
+	head, err := g.Repository.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	commit, err := g.Repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	f, err := commit.File(file)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// HeadFile returns the content and mode of file in the HEAD commit.
+// It reports false when file is not tracked.
+func (g *Git) HeadFile(file string) ([]byte, os.FileMode, bool, error) {
+	f, err := g.headTreeFile(file)
+	if err != nil || f == nil {
+		return nil, 0, false, err
+	}
+	contents, err := f.Contents()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	mode, err := f.Mode.ToOSFileMode()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return []byte(contents), mode.Perm(), true, nil
+}
+
+// HeadFileHash returns the blob hash of file in the HEAD commit.
+// It reports false when file is not tracked.
+func (g *Git) HeadFileHash(file string) (plumbing.Hash, bool, error) {
+	f, err := g.headTreeFile(file)
+	if err != nil || f == nil {
+		return plumbing.ZeroHash, false, err
+	}
+	return f.Hash, true, nil
+}
+
+// IndexEntries returns the entries of the index keyed by their slash-separated path
+func (g *Git) IndexEntries() (map[string]*index.Entry, error) {
+	idx, err := g.Repository.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*index.Entry, len(idx.Entries))
+	for _, entry := range idx.Entries {
+		entries[entry.Name] = entry
+	}
+	return entries, nil
+}
+
+// SetSkipWorktree sets the skip-worktree bit of the index entries of skip and
+// clears it for clear, like git update-index --[no-]skip-worktree. Files that
+// aren't in the index are ignored, and the index is only written when a bit changes.
+func (g *Git) SetSkipWorktree(ctx context.Context, skip, clear []string) error {
+	if len(skip) == 0 && len(clear) == 0 {
+		return nil
+	}
+	idx, err := g.Repository.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	changes := func(files []string, value bool) []*index.Entry {
+		entries := []*index.Entry{}
+		for _, file := range files {
+			entry, err := idx.Entry(file)
+			if err != nil {
+				continue
+			}
+			if entry.SkipWorktree != value {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+	toSkip, toClear := changes(skip, true), changes(clear, false)
+	if len(toSkip) == 0 && len(toClear) == 0 {
+		return nil
+	}
+
+	// go-git drops index extensions like the cache tree or the untracked cache
+	// when it writes the index, so git itself updates indexes that have them
+	lossless, err := g.indexRoundTrips(idx)
+	if err != nil {
+		return err
+	}
+	if !lossless {
+		if err := g.updateIndex(ctx, "--skip-worktree", toSkip); err != nil {
+			return err
+		}
+		return g.updateIndex(ctx, "--no-skip-worktree", toClear)
+	}
+
+	for _, entry := range toSkip {
+		entry.SkipWorktree = true
+	}
+	for _, entry := range toClear {
+		entry.SkipWorktree = false
+	}
+
+	// Extended entry flags need index version 3 or later
+	if idx.Version < 3 {
+		for _, entry := range idx.Entries {
+			if entry.SkipWorktree || entry.IntentToAdd {
+				idx.Version = 3
+				break
+			}
+		}
+	}
+
+	return g.Repository.Storer.SetIndex(idx)
+}
+
+// indexRoundTrips reports whether go-git writes idx back exactly as it is stored
+func (g *Git) indexRoundTrips(idx *index.Index) (bool, error) {
+	storage, ok := g.Repository.Storer.(*filesystem.Storage)
+	if !ok {
+		// Indexes kept in memory only hold what go-git wrote
+		return true, nil
+	}
+	stored, err := readFile(storage.Filesystem(), "index")
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var encoded bytes.Buffer
+	if err := index.NewEncoder(&encoded).Encode(idx); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(stored, encoded.Bytes()), nil
+}
+
+// updateIndex runs git update-index with flag for the files of entries
+func (g *Git) updateIndex(ctx context.Context, flag string, entries []*index.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("the git index has extensions ccoco can't preserve and git is not installed to update it: %w", err)
+	}
+
+	args := []string{"update-index", flag, "--"}
+	for _, entry := range entries {
+		args = append(args, entry.Name)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.Worktree.Filesystem.Root()
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git update-index %s failed: %w: %s", flag, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// BranchNames returns the sorted names of the local branches. When remotes is set,
+// the remote-tracking branches of remote, or of every remote when it is empty, are
+// included without their remote prefix.
+func (g *Git) BranchNames(remotes bool, remote string) ([]string, error) {
+	refs, err := g.Repository.References()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]struct{}{}
+	names := []string{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ""
+		switch {
+		case ref.Name().IsBranch():
+			name = ref.Name().Short()
+		case remotes && ref.Name().IsRemote():
+			// refs/remotes/<remote>/<branch>
+			parts := strings.SplitN(ref.Name().String(), "/", 4)
+			if len(parts) < 4 || parts[3] == "HEAD" || (remote != "" && parts[2] != remote) {
+				return nil
+			}
+			name = parts[3]
+		}
+		if _, ok := seen[name]; name != "" && !ok {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// BranchCommit returns the commit branch points to, falling back to a remote-tracking
+// branch when there is no local one. It returns nil when the branch doesn't exist.
+func (g *Git) BranchCommit(branch string) (*object.Commit, error) {
+	ref, err := g.Repository.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		remotes, err := g.Repository.Remotes()
+		if err != nil {
+			return nil, err
+		}
+		for _, remote := range remotes {
+			ref, err = g.Repository.Reference(plumbing.NewRemoteReferenceName(remote.Config().Name, branch), true)
+			if err == nil {
+				break
+			}
+		}
+		if ref == nil {
+			return nil, nil
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return g.Repository.CommitObject(ref.Hash())
+}
+
+// BranchRename is a branch rename recorded in the reflog
+type BranchRename struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	When time.Time `json:"when"`
+}
+
+// renamePattern matches the reflog message written by git branch -m
+var renamePattern = regexp.MustCompile(`^Branch: renamed refs/heads/(.+) to refs/heads/(.+)$`)
+
+// BranchRenames returns the branch renames recorded in the reflogs, oldest first
+func (g *Git) BranchRenames() ([]BranchRename, error) {
+	storage, ok := g.Repository.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, nil
+	}
+	fs := storage.Filesystem()
+
+	// The log of a renamed branch moves with it, and HEAD logs renames of the checked out branch
+	logs := []string{"logs/HEAD"}
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := fs.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			p := fs.Join(dir, entry.Name())
+			if entry.IsDir() {
+				if err := walk(p); err != nil {
+					return err
+				}
+				continue
+			}
+			logs = append(logs, p)
+		}
+		return nil
+	}
+	if err := walk("logs/refs/heads"); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]struct{}{}
+	renames := []BranchRename{}
+	for _, logPath := range logs {
+		f, err := fs.Open(logPath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// <old> <new> <name> <email> <timestamp> <timezone>\t<message>
+			line, message, ok := strings.Cut(scanner.Text(), "\t")
+			if !ok {
+				continue
+			}
+			match := renamePattern.FindStringSubmatch(message)
+			if match == nil {
+				continue
+			}
+			if _, ok := seen[scanner.Text()]; ok {
+				continue
+			}
+			seen[scanner.Text()] = struct{}{}
+
+			rename := BranchRename{From: match[1], To: match[2]}
+			if fields := strings.Fields(line); len(fields) >= 2 {
+				if seconds, err := strconv.ParseInt(fields[len(fields)-2], 10, 64); err == nil {
+					rename.When = time.Unix(seconds, 0)
+				}
+			}
+			renames = append(renames, rename)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(renames, func(i, j int) bool {
+		return renames[i].When.Before(renames[j].When)
+	})
+	return renames, nil
+}
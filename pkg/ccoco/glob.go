@@ -0,0 +1,163 @@
+package ccoco
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// isPattern reports whether an entry of Files is a glob pattern or a directory
+// rather than a single file. Directories are marked with a trailing slash.
+func isPattern(entry string) bool {
+	return strings.ContainsAny(entry, "*?[") || strings.HasSuffix(entry, "/")
+}
+
+// entryKey returns entry in the form entries are compared in, so that e.g.
+// certs, certs/ and ./certs are the same entry
+func entryKey(entry string) string {
+	return path.Clean(filepath.ToSlash(entry))
+}
+
+// isGlob reports whether entry contains glob characters
+func isGlob(entry string) bool {
+	return strings.ContainsAny(entry, "*?[")
+}
+
+// matchEntry reports whether the slash-separated file belongs to entry.
+// Globs follow path.Match per segment, with ** matching any number of segments.
+func matchEntry(entry, file string) bool {
+	if isGlob(entry) {
+		return matchGlob(strings.Split(strings.TrimSuffix(entry, "/"), "/"), strings.Split(file, "/"))
+	}
+	dir := strings.TrimSuffix(path.Clean(entry), "/")
+	return file == dir || strings.HasPrefix(file, dir+"/")
+}
+
+func matchGlob(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlob(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchGlob(pattern[1:], segments[1:])
+}
+
+// matchBranch reports whether branch matches one of patterns. Every branch matches when there are none.
+func matchBranch(patterns []string, branch string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchGlob(strings.Split(pattern, "/"), strings.Split(branch, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPattern validates the glob syntax of entry
+func checkPattern(entry string) error {
+	for _, segment := range strings.Split(entry, "/") {
+		if segment == "**" {
+			continue
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// staticPrefix returns the leading directories of entry that contain no glob characters
+func staticPrefix(entry string) string {
+	prefix := []string{}
+	for _, segment := range strings.Split(strings.TrimSuffix(entry, "/"), "/") {
+		if isGlob(segment) {
+			break
+		}
+		prefix = append(prefix, segment)
+	}
+	if len(prefix) == 0 {
+		return "."
+	}
+	return strings.Join(prefix, "/")
+}
+
+// isDirectoryEntry reports whether entry refers to a directory in the working tree
+func (c Ccoco) isDirectoryEntry(entry string) bool {
+	if isPattern(entry) {
+		return !isGlob(entry)
+	}
+	info, err := c.fs.Stat(filepath.Join(c.gitClient.RootPathFromCwd, entry))
+	return err == nil && info.IsDir()
+}
+
+// expandEntry expands a pattern or directory entry against the working tree.
+// It reports false for entries naming a single file.
+func (c Ccoco) expandEntry(entry string) ([]string, bool, error) {
+	if !c.isDirectoryEntry(entry) && !isGlob(entry) {
+		return nil, false, nil
+	}
+	if c.configFile.Content.Format() < StoreFormatManifest {
+		return nil, true, fmt.Errorf("%s requires store format %d, run ccoco migrate", entry, StoreFormatManifest)
+	}
+	files, err := c.expandWorkingTree(entry)
+	return files, true, err
+}
+
+// expandWorkingTree returns the regular files of the working tree matching entry
+// as sorted slash-separated paths relative to the repository root
+func (c Ccoco) expandWorkingTree(entry string) ([]string, error) {
+	root := filepath.Join(c.gitClient.RootPathFromCwd, filepath.FromSlash(staticPrefix(entry)))
+	ccocoRoot := filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Root)
+	gitDir := filepath.Join(c.gitClient.RootPathFromCwd, ".git")
+
+	files := []string{}
+	err := walkDir(c.fs, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if p == ccocoRoot || p == gitDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(c.gitClient.RootPathFromCwd, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if matchEntry(entry, rel) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
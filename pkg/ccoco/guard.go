@@ -0,0 +1,121 @@
+package ccoco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// GuardError is returned when the index contains managed files whose staged
+// content matches content stored for a branch
+type GuardError struct {
+	// Files maps each blocked file to the branches its staged content was found in
+	Files map[string][]string
+}
+
+func (e *GuardError) Error() string {
+	files := make([]string, 0, len(e.Files))
+	for file, branches := range e.Files {
+		files = append(files, fmt.Sprintf("%s (%s)", file, strings.Join(branches, ", ")))
+	}
+	sort.Strings(files)
+	return "staged content matches ccoco configs: " + strings.Join(files, "; ") +
+		". unstage the file/s or set SKIP_CCOCO_GUARD=1 to commit anyway"
+}
+
+// Is reports blocked commits as ErrDirtyFile
+func (e *GuardError) Is(target error) bool {
+	return target == ErrDirtyFile
+}
+
+// GuardSkipVariables are the environment variables skipping the guard when set to 1
+var GuardSkipVariables = []string{"SKIP_CCOCO", "SKIP_CCOCO_GUARD"}
+
+// GuardSkipped returns the environment variable set to skip the guard, or an empty string when none is
+func GuardSkipped() string {
+	for _, name := range GuardSkipVariables {
+		if os.Getenv(name) == "1" {
+			return name
+		}
+	}
+	return ""
+}
+
+// Guard checks the index for managed files staged with content stored for a
+// branch, so that branch-specific configs don't get committed by accident
+func (c Ccoco) Guard(ctx context.Context) error {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return ErrNotInitialized
+	}
+
+	entries, err := c.gitClient.IndexEntries()
+	if err != nil {
+		return err
+	}
+
+	// Only staged changes to managed files can be a problem
+	staged := map[plumbing.Hash][]string{}
+	for name, entry := range entries {
+		if !c.isManaged(name) {
+			continue
+		}
+		headHash, tracked, err := c.gitClient.HeadFileHash(name)
+		if err != nil {
+			return err
+		}
+		if tracked && headHash == entry.Hash {
+			continue
+		}
+		staged[entry.Hash] = append(staged[entry.Hash], name)
+	}
+	if len(staged) == 0 {
+		return nil
+	}
+
+	storedFiles, err := c.listStoredFiles()
+	if err != nil {
+		return err
+	}
+
+	blocked := map[string][]string{}
+	stores := map[string]*branchStore{}
+	for _, stored := range storedFiles {
+		store, exists := stores[stored.Branch]
+		if !exists {
+			store, err = c.openStore(stored.Branch)
+			if err != nil {
+				return err
+			}
+			stores[stored.Branch] = store
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// A stored file that can't be read can't be compared, so the commit is blocked
+		data, err := store.Read(stored.File)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("can't check %s of %s against the staged files: %w", stored.File, stored.Branch, err)
+		}
+		// Empty placeholders can't leak anything
+		if len(data) == 0 {
+			continue
+		}
+		for _, name := range staged[plumbing.ComputeHash(plumbing.BlobObject, data)] {
+			blocked[name] = append(blocked[name], stored.Branch)
+		}
+	}
+
+	if len(blocked) > 0 {
+		return &GuardError{Files: blocked}
+	}
+	return nil
+}
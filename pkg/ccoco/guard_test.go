@@ -0,0 +1,64 @@
+package ccoco
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestGuard(t *testing.T) {
+	tests := []struct {
+		name string
+		// staged is the content of .env added to the index
+		staged string
+		// dropKey removes the key after storing, so the stored files can't be read
+		dropKey   bool
+		wantErr   bool
+		wantDirty bool
+	}{
+		{name: "other content", staged: "local"},
+		{name: "stored content", staged: ".env", wantErr: true, wantDirty: true},
+		{name: "unreadable store", staged: "local", dropKey: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyFile := filepath.Join(t.TempDir(), "key")
+			t.Setenv(KeyEnv, "")
+			t.Setenv(KeyFileEnv, keyFile)
+			key, err := GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteKey(keyFile, key); err != nil {
+				t.Fatal(err)
+			}
+
+			c := newTestCcoco(t, &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env"}, Encrypt: true})
+			storeTestFiles(t, c, map[string][]string{"main": {".env"}})
+			if tt.dropKey {
+				t.Setenv(KeyFileEnv, filepath.Join(t.TempDir(), "missing"))
+			}
+
+			if err := writeFile(c.fs, ".env", []byte(tt.staged), 0644); err != nil {
+				t.Fatal(err)
+			}
+			worktree, err := c.gitClient.Repository.Worktree()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := worktree.Add(".env"); err != nil {
+				t.Fatal(err)
+			}
+
+			err = c.Guard(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Guard() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrDirtyFile) != tt.wantDirty {
+				t.Errorf("Guard() error = %v, want blocked commit %v", err, tt.wantDirty)
+			}
+		})
+	}
+}
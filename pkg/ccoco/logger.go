@@ -0,0 +1,19 @@
+package ccoco
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler drops every record, it is the default so embedding programs get no output
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// discardLogger returns a logger without output
+func discardLogger() *slog.Logger {
+	return slog.New(discardHandler{})
+}
@@ -0,0 +1,166 @@
+package ccoco
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// ManifestFileName is the sidecar file holding the metadata of a branch directory
+const ManifestFileName = ".ccoco-manifest.json"
+
+// Sources recorded in the manifest for where the stored content came from
+const (
+	SourceWorkingTree = "working-tree"
+	SourceEmpty       = "empty"
+	SourceMigration   = "migration"
+	SourceEdit        = "edit"
+	SourceImport      = "import"
+	SourceCopy        = "copy"
+	SourceDoctor      = "doctor"
+)
+
+type (
+	Manifest struct {
+		Files []ManifestEntry `json:"files"`
+	}
+	ManifestEntry struct {
+		Path      string    `json:"path"`
+		Hash      string    `json:"hash"`
+		Mode      string    `json:"mode"`
+		UpdatedAt time.Time `json:"updatedAt"`
+		Source    string    `json:"source"`
+	}
+)
+
+// Entry returns the manifest entry of file
+func (m *Manifest) Entry(file string) (ManifestEntry, bool) {
+	for _, entry := range m.Files {
+		if entry.Path == file {
+			return entry, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// Set adds or replaces the entry of a file, keeping entries sorted by path
+func (m *Manifest) Set(entry ManifestEntry) {
+	for i := range m.Files {
+		if m.Files[i].Path == entry.Path {
+			m.Files[i] = entry
+			return
+		}
+	}
+	m.Files = append(m.Files, entry)
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+}
+
+// Remove deletes the entry of a file
+func (m *Manifest) Remove(file string) {
+	for i := range m.Files {
+		if m.Files[i].Path == file {
+			m.Files = append(m.Files[:i], m.Files[i+1:]...)
+			return
+		}
+	}
+}
+
+// FileMode returns the parsed mode of the entry
+func (e ManifestEntry) FileMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(e.Mode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	return os.FileMode(mode).Perm(), nil
+}
+
+// newManifestEntry creates an entry describing content with hash stored for file at now
+func newManifestEntry(file, hash string, mode os.FileMode, source string, now time.Time) ManifestEntry {
+	return ManifestEntry{
+		Path:      file,
+		Hash:      hash,
+		Mode:      formatMode(mode),
+		UpdatedAt: now.UTC(),
+		Source:    source,
+	}
+}
+
+func hashData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// macData returns the hash of data keyed by the store key. Encrypted stores
+// record it instead of hashData, so their manifests can't confirm guesses of
+// the content.
+func macData(key, data []byte) string {
+	macKey := sha256.Sum256(append([]byte("ccoco manifest hash"), key...))
+	mac := hmac.New(sha256.New, macKey[:])
+	mac.Write(data)
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func formatMode(mode os.FileMode) string {
+	return "0" + strconv.FormatUint(uint64(mode.Perm()), 8)
+}
+
+// readManifest reads the manifest at path. A missing manifest is empty.
+func readManifest(fsys billy.Filesystem, path string) (*Manifest, error) {
+	manifest := &Manifest{Files: []ManifestEntry{}}
+	data, err := readFile(fsys, path)
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseManifest(data)
+}
+
+// parseManifest decodes a manifest. Manifests may come from a remote or an
+// external store, so every path must stay inside the directory it is applied to.
+func parseManifest(data []byte) (*Manifest, error) {
+	manifest := &Manifest{Files: []ManifestEntry{}}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+	for _, entry := range manifest.Files {
+		if !isSafeBundlePath(entry.Path) {
+			return nil, fmt.Errorf("unsafe path %q", entry.Path)
+		}
+	}
+	return manifest, nil
+}
+
+// writeManifest writes the manifest to path
+func writeManifest(fsys billy.Filesystem, path string, manifest *Manifest) error {
+	data, err := marshalManifest(manifest)
+	if err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFile(fsys, path, data, 0644)
+}
+
+// marshalManifest encodes the manifest the way it is stored
+func marshalManifest(manifest *Manifest) ([]byte, error) {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,105 @@
+package ccoco
+
+import "time"
+
+// Observer is notified while Run and ChangeConfigFiles apply a config set.
+// Embed NopObserver to only implement some of the methods.
+type Observer interface {
+	// OnPreflight is called once the plan is known, before any check or write.
+	// Returning an error aborts without touching the working tree.
+	OnPreflight(PreflightEvent) error
+	// OnBeforeApply is called right before the working tree is changed
+	OnBeforeApply(ApplyEvent)
+	// OnFileApplied is called for every file written, restored or removed.
+	// The file is rolled back again when a later file fails.
+	OnFileApplied(FileEvent)
+	// OnFileSkipped is called for every file left as it is
+	OnFileSkipped(FileEvent)
+	// OnAfterApply is called last by every run, once the config set is applied or
+	// with the error that stopped it, e.g. a branch without configs, a veto of
+	// OnPreflight or a rolled back apply
+	OnAfterApply(AfterApplyEvent)
+}
+
+type (
+	// PreflightEvent is the plan of a config set
+	PreflightEvent struct {
+		// Branch is the branch the configs are applied for
+		Branch string
+		// ConfigBranch is the branch directory the configs are applied from
+		ConfigBranch string
+		// RenamedFrom is the old name of the branch when its configs were moved along
+		RenamedFrom string
+		// SeededFrom is the branch new configs of the branch were copied from
+		SeededFrom string
+		Files      []FileStatus
+		DryRun     bool
+	}
+	// ApplyEvent is a config set about to be applied
+	ApplyEvent struct {
+		Branch       string
+		ConfigBranch string
+		Files        []FileStatus
+		DryRun       bool
+	}
+	// FileEvent is a single file of a config set
+	FileEvent struct {
+		Branch       string
+		ConfigBranch string
+		Status       FileStatus
+		// Path is the path of the file relative to the current directory
+		Path   string
+		DryRun bool
+	}
+	// AfterApplyEvent is the outcome of applying a config set
+	AfterApplyEvent struct {
+		// Branch and ConfigBranch are empty when the run failed before finding them
+		Branch       string
+		ConfigBranch string
+		// Result is nil when the config set wasn't applied
+		Result *RunResult
+		// Err is the reason the config set wasn't applied, an *ApplyError when it was rolled back
+		Err      error
+		Duration time.Duration
+		DryRun   bool
+	}
+)
+
+// NopObserver ignores every event
+type NopObserver struct{}
+
+func (NopObserver) OnPreflight(PreflightEvent) error { return nil }
+func (NopObserver) OnBeforeApply(ApplyEvent)         {}
+func (NopObserver) OnFileApplied(FileEvent)          {}
+func (NopObserver) OnFileSkipped(FileEvent)          {}
+func (NopObserver) OnAfterApply(AfterApplyEvent)     {}
+
+// WithObserver adds an observer to the instance. Observers are called in the order they were added.
+func WithObserver(observer Observer) Option {
+	return func(c *Ccoco) {
+		c.observers = append(c.observers, observer)
+	}
+}
+
+// preflight calls OnPreflight of every observer, stopping at the first error
+func (c Ccoco) preflight(event PreflightEvent) error {
+	for _, observer := range c.observers {
+		if err := observer.OnPreflight(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterApply calls OnAfterApply of every observer with the outcome of a run started at start
+func (c Ccoco) afterApply(branch, configBranch string, start time.Time, result *RunResult, err error) {
+	event := AfterApplyEvent{Branch: branch, ConfigBranch: configBranch, Result: result, Err: err, Duration: c.now().Sub(start), DryRun: c.dryRun}
+	c.notify(func(o Observer) { o.OnAfterApply(event) })
+}
+
+// notify calls fn with every observer
+func (c Ccoco) notify(fn func(Observer)) {
+	for _, observer := range c.observers {
+		fn(observer)
+	}
+}
@@ -0,0 +1,99 @@
+package ccoco
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// recordingObserver records the events it is notified of
+type recordingObserver struct {
+	NopObserver
+	veto   error
+	events []string
+	after  *AfterApplyEvent
+}
+
+func (o *recordingObserver) OnPreflight(PreflightEvent) error {
+	o.events = append(o.events, "preflight")
+	return o.veto
+}
+
+func (o *recordingObserver) OnBeforeApply(ApplyEvent) {
+	o.events = append(o.events, "before")
+}
+
+func (o *recordingObserver) OnAfterApply(event AfterApplyEvent) {
+	o.events = append(o.events, "after")
+	o.after = &event
+}
+
+func TestObserverAfterApply(t *testing.T) {
+	errVeto := errors.New("vetoed")
+
+	tests := []struct {
+		name       string
+		branch     string
+		options    map[string]FileOptions
+		veto       error
+		wantEvents []string
+		wantErr    error
+	}{
+		{
+			name:       "applied",
+			wantEvents: []string{"preflight", "before", "after"},
+		},
+		{
+			name:       "vetoed",
+			veto:       errVeto,
+			wantEvents: []string{"preflight", "after"},
+			wantErr:    errVeto,
+		},
+		{
+			name:       "missing file that must not be kept",
+			options:    map[string]FileOptions{"secret": {OnMissing: OnMissingFail}},
+			wantEvents: []string{"preflight", "after"},
+			wantErr:    ErrNoConfig,
+		},
+		{
+			name:       "branch without configs",
+			branch:     "develop",
+			wantEvents: []string{"after"},
+			wantErr:    ErrNoConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCcoco(t, &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env", "secret"}, Options: tt.options})
+			storeTestFiles(t, c, map[string][]string{"main": {".env"}})
+			observer := &recordingObserver{veto: tt.veto}
+			c.observers = []Observer{observer}
+
+			branch := "main"
+			if tt.branch != "" {
+				branch = tt.branch
+			}
+			result, err := c.Run(context.Background(), RunOptions{ForceToBranch: &branch})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if !equalStrings(observer.events, tt.wantEvents) {
+				t.Errorf("events = %v, want %v", observer.events, tt.wantEvents)
+			}
+			if observer.after == nil {
+				t.Fatal("OnAfterApply was not called")
+			}
+			if !errors.Is(observer.after.Err, tt.wantErr) {
+				t.Errorf("AfterApplyEvent.Err = %v, want %v", observer.after.Err, tt.wantErr)
+			}
+			if observer.after.Branch != branch {
+				t.Errorf("AfterApplyEvent.Branch = %q, want %q", observer.after.Branch, branch)
+			}
+			if observer.after.Result != result {
+				t.Errorf("AfterApplyEvent.Result = %v, want %v", observer.after.Result, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,385 @@
+package ccoco
+
+import (
+	"errors"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/helper/chroot"
+	"github.com/go-git/go-billy/v5/memfs"
+)
+
+// overlayFilesystem reads through to base and keeps every change in memory,
+// so base is never written to
+type overlayFilesystem struct {
+	base  billy.Filesystem
+	upper billy.Filesystem
+
+	mu sync.Mutex
+	// deleted holds the paths of base hidden by a remove or a rename
+	deleted map[string]bool
+}
+
+// NewOverlayFilesystem returns a filesystem that reads from base and keeps
+// every write, rename and removal in memory, leaving base untouched
+func NewOverlayFilesystem(base billy.Filesystem) billy.Filesystem {
+	return &overlayFilesystem{base: base, upper: memfs.New(), deleted: map[string]bool{}}
+}
+
+// upperPath maps name to its path in the in-memory layer. Relative paths
+// may climb out of the current directory, so the number of leading ".."
+// is kept as a path element of its own.
+func upperPath(name string) string {
+	name = filepath.Clean(name)
+	if filepath.IsAbs(name) {
+		return filepath.Join("/abs", name)
+	}
+	up := 0
+	for name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		up++
+		name = strings.TrimPrefix(strings.TrimPrefix(name, ".."), string(filepath.Separator))
+	}
+	return filepath.Join("/rel", strconv.Itoa(up), name)
+}
+
+// inUpper reports whether name has been written to the in-memory layer
+func (o *overlayFilesystem) inUpper(name string) bool {
+	_, err := o.upper.Lstat(upperPath(name))
+	return err == nil
+}
+
+// hidden reports whether name or one of its parents was removed from base
+func (o *overlayFilesystem) hidden(name string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for current := filepath.Clean(name); ; current = filepath.Dir(current) {
+		if o.deleted[current] {
+			return true
+		}
+		if filepath.Dir(current) == current {
+			return false
+		}
+	}
+}
+
+func (o *overlayFilesystem) hide(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.deleted[filepath.Clean(name)] = true
+}
+
+func notExist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
+
+// copyUp copies name and everything below it from base to the in-memory layer
+func (o *overlayFilesystem) copyUp(name string) error {
+	if o.inUpper(name) || o.hidden(name) {
+		return nil
+	}
+	info, err := o.base.Lstat(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return o.copyUpInfo(name, info)
+}
+
+func (o *overlayFilesystem) copyUpInfo(name string, info os.FileInfo) error {
+	upper := upperPath(name)
+	switch {
+	case info.IsDir():
+		if err := o.upper.MkdirAll(upper, info.Mode().Perm()); err != nil {
+			return err
+		}
+		entries, err := o.base.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := o.copyUp(filepath.Join(name, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := o.base.Readlink(name)
+		if err != nil {
+			return err
+		}
+		return o.upper.Symlink(target, upper)
+	default:
+		data, err := readFile(o.base, name)
+		if err != nil {
+			return err
+		}
+		return writeFile(o.upper, upper, data, info.Mode().Perm())
+	}
+}
+
+func (o *overlayFilesystem) Create(filename string) (billy.File, error) {
+	return o.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (o *overlayFilesystem) Open(filename string) (billy.File, error) {
+	return o.OpenFile(filename, os.O_RDONLY, 0)
+}
+
+func (o *overlayFilesystem) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		if o.inUpper(filename) {
+			f, err := o.upper.OpenFile(upperPath(filename), flag, perm)
+			if err != nil {
+				return nil, err
+			}
+			return &overlayFile{File: f, name: filename}, nil
+		}
+		if o.hidden(filename) {
+			return nil, notExist("open", filename)
+		}
+		return o.base.OpenFile(filename, flag, perm)
+	}
+
+	if flag&os.O_EXCL != 0 {
+		if _, err := o.Lstat(filename); err == nil {
+			return nil, &os.PathError{Op: "open", Path: filename, Err: os.ErrExist}
+		}
+	}
+	if flag&os.O_TRUNC == 0 {
+		if err := o.copyUp(filename); err != nil {
+			return nil, err
+		}
+	}
+	f, err := o.upper.OpenFile(upperPath(filename), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &overlayFile{File: f, name: filename}, nil
+}
+
+func (o *overlayFilesystem) Stat(filename string) (os.FileInfo, error) {
+	for links := 0; links < 255; links++ {
+		info, err := o.Lstat(filename)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return info, err
+		}
+		target, err := o.Readlink(filename)
+		if err != nil {
+			return nil, err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(filename), target)
+		}
+		filename = target
+	}
+	return nil, &os.PathError{Op: "stat", Path: filename, Err: errors.New("too many levels of symbolic links")}
+}
+
+func (o *overlayFilesystem) Lstat(filename string) (os.FileInfo, error) {
+	if info, err := o.upper.Lstat(upperPath(filename)); err == nil {
+		return renamedInfo{info, filepath.Base(filename)}, nil
+	}
+	if o.hidden(filename) {
+		return nil, notExist("lstat", filename)
+	}
+	return o.base.Lstat(filename)
+}
+
+func (o *overlayFilesystem) Rename(oldpath, newpath string) error {
+	if _, err := o.Lstat(oldpath); err != nil {
+		return err
+	}
+	if err := o.copyUp(oldpath); err != nil {
+		return err
+	}
+	if err := o.upper.MkdirAll(filepath.Dir(upperPath(newpath)), 0755); err != nil {
+		return err
+	}
+	if err := removeAll(o.upper, upperPath(newpath)); err != nil {
+		return err
+	}
+	if err := o.upper.Rename(upperPath(oldpath), upperPath(newpath)); err != nil {
+		return err
+	}
+	// Whatever base has at newpath is replaced, and oldpath is gone
+	o.hide(newpath)
+	o.hide(oldpath)
+	return nil
+}
+
+func (o *overlayFilesystem) Remove(filename string) error {
+	info, err := o.Lstat(filename)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := o.ReadDir(filename)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &os.PathError{Op: "remove", Path: filename, Err: errors.New("directory not empty")}
+		}
+	}
+	if o.inUpper(filename) {
+		if err := removeAll(o.upper, upperPath(filename)); err != nil {
+			return err
+		}
+	}
+	o.hide(filename)
+	return nil
+}
+
+func (o *overlayFilesystem) Join(elem ...string) string {
+	return filepath.Join(elem...)
+}
+
+func (o *overlayFilesystem) TempFile(dir, prefix string) (billy.File, error) {
+	for {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := o.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+}
+
+func (o *overlayFilesystem) ReadDir(path string) ([]os.FileInfo, error) {
+	seen := map[string]bool{}
+	infos := []os.FileInfo{}
+	found := false
+
+	if o.inUpper(path) {
+		entries, err := o.upper.ReadDir(upperPath(path))
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		for _, entry := range entries {
+			seen[entry.Name()] = true
+			infos = append(infos, entry)
+		}
+	}
+	if !o.hidden(path) {
+		entries, err := o.base.ReadDir(path)
+		if err != nil && (!os.IsNotExist(err) || !found) {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if seen[entry.Name()] || o.hidden(filepath.Join(path, entry.Name())) {
+				continue
+			}
+			infos = append(infos, entry)
+		}
+	} else if !found {
+		return nil, notExist("readdir", path)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
+
+func (o *overlayFilesystem) MkdirAll(filename string, perm os.FileMode) error {
+	if info, err := o.Stat(filename); err == nil {
+		if !info.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: filename, Err: errors.New("not a directory")}
+		}
+		return nil
+	}
+	return o.upper.MkdirAll(upperPath(filename), perm)
+}
+
+func (o *overlayFilesystem) Symlink(target, link string) error {
+	if _, err := o.Lstat(link); err == nil {
+		return &os.LinkError{Op: "symlink", Old: target, New: link, Err: os.ErrExist}
+	}
+	return o.upper.Symlink(target, upperPath(link))
+}
+
+func (o *overlayFilesystem) Readlink(link string) (string, error) {
+	if o.inUpper(link) {
+		return o.upper.Readlink(upperPath(link))
+	}
+	if o.hidden(link) {
+		return "", notExist("readlink", link)
+	}
+	return o.base.Readlink(link)
+}
+
+func (o *overlayFilesystem) Chroot(path string) (billy.Filesystem, error) {
+	return chroot.New(o, path), nil
+}
+
+func (o *overlayFilesystem) Root() string {
+	return o.base.Root()
+}
+
+// Chmod recreates the file in memory with mode, the in-memory layer can't change modes
+func (o *overlayFilesystem) Chmod(name string, mode os.FileMode) error {
+	info, err := o.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm() == mode.Perm() {
+		return nil
+	}
+	data, err := readFile(o, name)
+	if err != nil {
+		return err
+	}
+	upper := upperPath(name)
+	if err := removeAll(o.upper, upper); err != nil {
+		return err
+	}
+	return writeFile(o.upper, upper, data, mode.Perm())
+}
+
+// Lchown is a no-op, the in-memory layer has no owners
+func (o *overlayFilesystem) Lchown(name string, uid, gid int) error {
+	_, err := o.Lstat(name)
+	return err
+}
+
+// Chown is a no-op, the in-memory layer has no owners
+func (o *overlayFilesystem) Chown(name string, uid, gid int) error {
+	_, err := o.Stat(name)
+	return err
+}
+
+// Chtimes is a no-op, the in-memory layer has no times
+func (o *overlayFilesystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	_, err := o.Stat(name)
+	return err
+}
+
+// overlayFile is a file of the in-memory layer named like its overlay path
+type overlayFile struct {
+	billy.File
+	name string
+}
+
+func (f *overlayFile) Name() string {
+	return f.name
+}
+
+// renamedInfo is a FileInfo of the in-memory layer named like its overlay path
+type renamedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (i renamedInfo) Name() string {
+	return i.name
+}
@@ -0,0 +1,194 @@
+package ccoco
+
+import (
+	"os"
+	"testing"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+)
+
+func TestOverlayFilesystem(t *testing.T) {
+	initial := map[string]string{
+		"/.env":        "old env",
+		"/config.json": "old config",
+		"/dir/a":       "a",
+		"/dir/b":       "b",
+	}
+	// with returns initial changed by changes, an empty content removes the file
+	with := func(changes map[string]string) map[string]string {
+		files := map[string]string{}
+		for path, content := range initial {
+			files[path] = content
+		}
+		for path, content := range changes {
+			if content == "" {
+				delete(files, path)
+			} else {
+				files[path] = content
+			}
+		}
+		return files
+	}
+
+	tests := []struct {
+		name    string
+		run     func(fsys billy.Filesystem) error
+		wantErr bool
+		want    map[string]string
+		// wantModes are the modes of files after run
+		wantModes map[string]os.FileMode
+		// wantLinks are the targets of symbolic links after run
+		wantLinks map[string]string
+	}{
+		{
+			name: "writes a new file",
+			run: func(fsys billy.Filesystem) error {
+				return writeFile(fsys, "/new/file", []byte("new"), 0600)
+			},
+			want:      with(map[string]string{"/new/file": "new"}),
+			wantModes: map[string]os.FileMode{"/new/file": 0600},
+		},
+		{
+			name: "overwrites a file",
+			run: func(fsys billy.Filesystem) error {
+				return writeFile(fsys, "/.env", []byte("new env"), 0644)
+			},
+			want: with(map[string]string{"/.env": "new env"}),
+		},
+		{
+			name: "appends to a file",
+			run: func(fsys billy.Filesystem) error {
+				f, err := fsys.OpenFile("/.env", os.O_WRONLY|os.O_APPEND, 0)
+				if err != nil {
+					return err
+				}
+				if _, err := f.Write([]byte("\nmore")); err != nil {
+					f.Close()
+					return err
+				}
+				return f.Close()
+			},
+			want: with(map[string]string{"/.env": "old env\nmore"}),
+		},
+		{
+			name: "removes a file",
+			run: func(fsys billy.Filesystem) error {
+				return fsys.Remove("/.env")
+			},
+			want: with(map[string]string{"/.env": ""}),
+		},
+		{
+			name: "recreates a removed file",
+			run: func(fsys billy.Filesystem) error {
+				if err := fsys.Remove("/.env"); err != nil {
+					return err
+				}
+				return writeFile(fsys, "/.env", []byte("new env"), 0644)
+			},
+			want: with(map[string]string{"/.env": "new env"}),
+		},
+		{
+			name: "renames a file over another",
+			run: func(fsys billy.Filesystem) error {
+				return fsys.Rename("/.env", "/config.json")
+			},
+			want: with(map[string]string{"/.env": "", "/config.json": "old env"}),
+		},
+		{
+			name: "renames a directory",
+			run: func(fsys billy.Filesystem) error {
+				return fsys.Rename("/dir", "/moved")
+			},
+			want: with(map[string]string{"/dir/a": "", "/dir/b": "", "/moved/a": "a", "/moved/b": "b"}),
+		},
+		{
+			name: "removes an emptied directory",
+			run: func(fsys billy.Filesystem) error {
+				return removeAll(fsys, "/dir")
+			},
+			want: with(map[string]string{"/dir/a": "", "/dir/b": ""}),
+		},
+		{
+			name: "refuses to remove a directory with files",
+			run: func(fsys billy.Filesystem) error {
+				return fsys.Remove("/dir")
+			},
+			wantErr: true,
+			want:    initial,
+		},
+		{
+			name: "changes the mode of a file",
+			run: func(fsys billy.Filesystem) error {
+				return chmod(fsys, "/.env", 0600)
+			},
+			want:      initial,
+			wantModes: map[string]os.FileMode{"/.env": 0600},
+		},
+		{
+			name: "creates a symbolic link",
+			run: func(fsys billy.Filesystem) error {
+				return fsys.Symlink("/dir/a", "/link")
+			},
+			want:      initial,
+			wantLinks: map[string]string{"/link": "/dir/a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := memfs.New()
+			for path, content := range initial {
+				if err := base.MkdirAll("/dir", 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := writeFile(base, path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			overlay := NewOverlayFilesystem(base)
+
+			if err := tt.run(overlay); (err != nil) != tt.wantErr {
+				t.Fatalf("run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			got := listTestFiles(t, overlay)
+			if len(got) != len(tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+			for path, content := range tt.want {
+				if got[path] != content {
+					t.Errorf("%s = %q, want %q", path, got[path], content)
+				}
+			}
+			for path, mode := range tt.wantModes {
+				info, err := overlay.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != mode {
+					t.Errorf("mode of %s = %s, want %s", path, info.Mode().Perm(), mode)
+				}
+			}
+			for link, target := range tt.wantLinks {
+				if got, err := overlay.Readlink(link); err != nil || got != target {
+					t.Errorf("Readlink(%s) = %q, %v, want %q", link, got, err, target)
+				}
+			}
+
+			// The base filesystem is never written to
+			baseFiles := listTestFiles(t, base)
+			if len(baseFiles) != len(initial) {
+				t.Errorf("base files = %v, want %v", baseFiles, initial)
+			}
+			for path, content := range initial {
+				if baseFiles[path] != content {
+					t.Errorf("base %s = %q, want %q", path, baseFiles[path], content)
+				}
+			}
+			if info, err := base.Stat("/.env"); err != nil || info.Mode().Perm() != 0644 {
+				t.Errorf("base mode of /.env = %v, %v, want 0644", info, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package ccoco
+
+import (
+	"os"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// chownLike is a no-op on platforms without unix file ownership
+func chownLike(fsys billy.Filesystem, path string, info os.FileInfo) error {
+	return nil
+}
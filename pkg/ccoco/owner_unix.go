@@ -0,0 +1,35 @@
+//go:build unix
+
+package ccoco
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// chownLike gives path the owner and group of info, which describes the file it replaces
+func chownLike(fsys billy.Filesystem, path string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	change, ok := fsys.(billy.Change)
+	if !ok {
+		return nil
+	}
+	current, err := fsys.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if currentStat, ok := current.Sys().(*syscall.Stat_t); ok && currentStat.Uid == stat.Uid && currentStat.Gid == stat.Gid {
+		return nil
+	}
+	// Only privileged users can give files away, so ownership is kept on a best-effort basis
+	if err := change.Lchown(path, int(stat.Uid), int(stat.Gid)); err != nil && !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	return nil
+}
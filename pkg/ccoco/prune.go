@@ -0,0 +1,148 @@
+package ccoco
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	PruneOptions struct {
+		// DryRun only reports the stale branch directories
+		DryRun bool
+		// OlderThan keeps stale branch directories modified more recently than this
+		OlderThan time.Duration
+		// Remotes keeps the configs of branches that only exist on a remote
+		Remotes bool
+		// Archive exports the stale configs to this bundle before they are deleted
+		Archive string
+	}
+	// PrunedBranch is a branch directory without a matching branch
+	PrunedBranch struct {
+		Branch string `json:"branch"`
+		Files  int    `json:"files"`
+		// ModTime is the last time a stored file of the branch was modified
+		ModTime time.Time `json:"modTime"`
+		// Pruned reports whether the configs were deleted, or would be on a dry run
+		Pruned bool   `json:"pruned"`
+		Reason string `json:"reason,omitempty"`
+	}
+)
+
+// Prune deletes the configs of branches that no longer exist
+func (c Ccoco) Prune(ctx context.Context, opts PruneOptions) ([]PrunedBranch, error) {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return nil, ErrNotInitialized
+	}
+
+	branchNames, err := c.gitClient.BranchNames(opts.Remotes, "")
+	if err != nil {
+		return nil, err
+	}
+	live := map[string]bool{}
+	for _, branch := range branchNames {
+		live[branch] = true
+	}
+
+	storedFiles, err := c.listStoredFiles()
+	if err != nil {
+		return nil, err
+	}
+	filesByBranch := map[string][]string{}
+	for _, stored := range storedFiles {
+		filesByBranch[stored.Branch] = append(filesByBranch[stored.Branch], stored.File)
+	}
+
+	stale := []PrunedBranch{}
+	for branch, files := range filesByBranch {
+		if live[branch] || branch == c.configFile.Content.Base {
+			continue
+		}
+		// Sub-branch roots are still applied to the branches nested below them
+		inUse := false
+		for liveBranch := range live {
+			if strings.HasPrefix(liveBranch, branch+"/") {
+				inUse = true
+				break
+			}
+		}
+		if inUse {
+			continue
+		}
+
+		pruned := PrunedBranch{Branch: branch, Files: len(files), Pruned: true}
+		for _, file := range files {
+			if info, err := c.fs.Stat(c.storePath(branch, file)); err == nil && info.ModTime().After(pruned.ModTime) {
+				pruned.ModTime = info.ModTime()
+			}
+		}
+		if opts.OlderThan > 0 && c.now().Sub(pruned.ModTime) < opts.OlderThan {
+			pruned.Pruned = false
+			pruned.Reason = "modified recently"
+		}
+		stale = append(stale, pruned)
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].Branch < stale[j].Branch
+	})
+
+	branches := []string{}
+	for _, pruned := range stale {
+		if pruned.Pruned {
+			branches = append(branches, pruned.Branch)
+		}
+	}
+	if opts.DryRun || len(branches) == 0 {
+		return stale, nil
+	}
+
+	if opts.Archive != "" {
+		f, err := c.fs.OpenFile(opts.Archive, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.Export(ctx, f, ExportOptions{Branches: branches}); err != nil {
+			f.Close()
+			_ = c.fs.Remove(opts.Archive)
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+		c.logger.Info("Archived configs", "branches", len(branches), "bundle", opts.Archive)
+	}
+
+	for _, branch := range branches {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := c.deleteBranchConfigs(branch, filesByBranch[branch]); err != nil {
+			return nil, err
+		}
+		c.logger.Info("Pruned configs", "branch", branch)
+	}
+	return stale, nil
+}
+
+// deleteBranchConfigs removes the stored files of branch without touching the
+// branch directories nested inside it
+func (c Ccoco) deleteBranchConfigs(branch string, files []string) error {
+	for _, file := range files {
+		path := c.storePath(branch, file)
+		if err := c.fs.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		c.removeEmptyDirs(filepath.Dir(path))
+	}
+	manifestPath := filepath.Join(c.branchPath(branch), ManifestFileName)
+	if err := c.fs.Remove(manifestPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	c.removeEmptyDirs(c.branchPath(branch))
+	return nil
+}
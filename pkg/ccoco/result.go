@@ -0,0 +1,51 @@
+package ccoco
+
+// Actions recorded for stored files and the files of the config
+const (
+	ActionStore  = "store"
+	ActionAdd    = "add"
+	ActionRemove = "remove"
+)
+
+type (
+	// RunResult is what Run did to the working tree
+	RunResult struct {
+		// Branch is the branch the configs were applied for
+		Branch string `json:"branch"`
+		// ConfigBranch is the branch directory the configs were applied from
+		ConfigBranch string `json:"configBranch"`
+		// RenamedFrom is the old name of the branch when its configs were moved along
+		RenamedFrom string `json:"renamedFrom,omitempty"`
+		// SeededFrom is the branch new configs of the branch were copied from
+		SeededFrom string       `json:"seededFrom,omitempty"`
+		Files      []FileStatus `json:"files"`
+	}
+	// GenerateResult is what GenerateConfigs stored for every branch
+	GenerateResult struct {
+		Branches []BranchChange `json:"branches"`
+	}
+	// SaveResult is what Save stored for the current branch
+	SaveResult struct {
+		Branch string       `json:"branch"`
+		Files  []FileChange `json:"files"`
+	}
+	// ConfigFilesResult is what AddToFiles and RemoveFromFiles changed in the config
+	ConfigFilesResult struct {
+		Files []FileChange `json:"files"`
+		// Config is the resulting list of files in the config
+		Config []string `json:"config"`
+	}
+	BranchChange struct {
+		Branch string `json:"branch"`
+		// SeededFrom is the branch the configs were copied from instead of being generated
+		SeededFrom string       `json:"seededFrom,omitempty"`
+		Files      []FileChange `json:"files"`
+	}
+	FileChange struct {
+		File   string `json:"file"`
+		Action string `json:"action"`
+		// Source is where stored content came from
+		Source string `json:"source,omitempty"`
+		Reason string `json:"reason,omitempty"`
+	}
+)
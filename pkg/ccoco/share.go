@@ -0,0 +1,685 @@
+package ccoco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// StoreRef is the orphan ref the config store is committed to
+const StoreRef = "refs/ccoco/store"
+
+// DefaultRemote is the remote used when pushing or pulling without one
+const DefaultRemote = "origin"
+
+// Strategies resolving files changed on both sides when the store is merged
+const (
+	MergeOurs   = "ours"
+	MergeTheirs = "theirs"
+)
+
+type (
+	PushOptions struct {
+		Remote   string
+		Strategy string
+		// AllowPlaintext pushes a store that isn't fully encrypted
+		AllowPlaintext bool
+	}
+	PullOptions struct {
+		Remote   string
+		Strategy string
+	}
+)
+
+// MergeConflictError is returned when both sides changed the same stored files and no strategy was given
+type MergeConflictError struct {
+	Files []string
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("conflicting changes to %s, merge again with the %s or %s strategy", strings.Join(e.Files, ", "), MergeOurs, MergeTheirs)
+}
+
+// storeEntry is a file of the committed store
+type storeEntry struct {
+	Hash plumbing.Hash
+	Mode filemode.FileMode
+}
+
+// storeFiles maps slash-separated paths relative to the configs directory to their entry
+type storeFiles map[string]storeEntry
+
+// Push commits the config store and pushes it to the StoreRef of a remote,
+// merging the changes pushed by others first. Stores that aren't fully
+// encrypted are refused unless opts.AllowPlaintext is set.
+func (c Ccoco) Push(ctx context.Context, opts PushOptions) error {
+	remote := opts.Remote
+	if remote == "" {
+		remote = DefaultRemote
+	}
+
+	if !opts.AllowPlaintext {
+		if err := c.checkEncrypted(); err != nil {
+			return err
+		}
+	}
+	if err := c.syncStore(ctx, remote, opts.Strategy); err != nil {
+		return err
+	}
+
+	err := c.gitClient.Repository.PushContext(ctx, &git.PushOptions{
+		RemoteName: remote,
+		RefSpecs:   []config.RefSpec{config.RefSpec(StoreRef + ":" + StoreRef)},
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		c.logger.Info("Store is up to date", "remote", remote)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.logger.Info("Pushed the store", "remote", remote)
+	return nil
+}
+
+// checkEncrypted fails with ErrPlaintextStore when the store would reveal the
+// content of a stored file, through the file itself or its manifest hash
+func (c Ccoco) checkEncrypted() error {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return ErrNotInitialized
+	}
+	if !c.configFile.Content.Encrypt {
+		return fmt.Errorf("%w, set \"encrypt\": true in %s and run ccoco rekey first", ErrPlaintextStore, c.configFile.Name)
+	}
+
+	storedFiles, err := c.listStoredFiles()
+	if err != nil {
+		return err
+	}
+	stores := map[string]*branchStore{}
+	for _, stored := range storedFiles {
+		data, err := readFile(c.fs, c.storePath(stored.Branch, stored.File))
+		if err != nil {
+			return err
+		}
+		if !isEncrypted(data) {
+			return fmt.Errorf("%w, %s of %s is stored in plaintext, run ccoco rekey first", ErrPlaintextStore, stored.File, stored.Branch)
+		}
+		store, ok := stores[stored.Branch]
+		if !ok {
+			store, err = c.openStore(stored.Branch)
+			if err != nil {
+				return err
+			}
+			stores[stored.Branch] = store
+		}
+		if entry, ok := store.manifest.Entry(stored.File); ok && strings.HasPrefix(entry.Hash, "sha256:") {
+			return fmt.Errorf("%w, the manifest of %s records the plain hash of %s, run ccoco rekey first", ErrPlaintextStore, stored.Branch, stored.File)
+		}
+	}
+	return nil
+}
+
+// Pull fetches the StoreRef of a remote and merges it into the config store
+func (c Ccoco) Pull(ctx context.Context, opts PullOptions) error {
+	remote := opts.Remote
+	if remote == "" {
+		remote = DefaultRemote
+	}
+
+	if err := c.syncStore(ctx, remote, opts.Strategy); err != nil {
+		return err
+	}
+
+	c.logger.Info("Pulled the store, run ccoco run to apply it", "remote", remote)
+	return nil
+}
+
+// syncStore commits the local config store, merges the store of remote into it
+// and writes the result back to the configs directory
+func (c Ccoco) syncStore(ctx context.Context, remote, strategy string) error {
+	if c.dryRun {
+		return ErrDryRun
+	}
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return ErrNotInitialized
+	}
+	if source := c.configFile.Content.Store; source != nil {
+		return fmt.Errorf("the store is kept in %s, share it from there", source.Location())
+	}
+	if strategy != "" && strategy != MergeOurs && strategy != MergeTheirs {
+		return fmt.Errorf("invalid merge strategy %q, expected %s or %s", strategy, MergeOurs, MergeTheirs)
+	}
+
+	repository := c.gitClient.Repository
+
+	local, err := c.commitStore()
+	if err != nil {
+		return err
+	}
+	working, err := c.gitClient.commitFiles(local)
+	if err != nil {
+		return err
+	}
+
+	// Fetch into a remote-tracking ref so the local store is only changed by the merge
+	tracking := plumbing.ReferenceName("refs/ccoco/remotes/" + remote + "/store")
+	err = repository.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: remote,
+		RefSpecs:   []config.RefSpec{config.RefSpec("+" + StoreRef + ":" + tracking.String())},
+	})
+	if errors.Is(err, git.NoMatchingRefSpecError{}) || errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		c.logger.Info("Remote has no store yet", "remote", remote)
+		return nil
+	}
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+	ref, err := repository.Reference(tracking, true)
+	if err != nil {
+		return err
+	}
+
+	merged, err := c.mergeStore(local, ref.Hash(), strategy)
+	if err != nil {
+		return err
+	}
+	// The merge is only stored, nothing is lost when the checkout is cancelled
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if merged == local.Hash {
+		return nil
+	}
+	if err := repository.Storer.SetReference(plumbing.NewHashReference(StoreRef, merged)); err != nil {
+		return err
+	}
+
+	mergedCommit, err := repository.CommitObject(merged)
+	if err != nil {
+		return err
+	}
+	files, err := c.gitClient.commitFiles(mergedCommit)
+	if err != nil {
+		return err
+	}
+	return c.checkoutStore(working, files)
+}
+
+// commitStore commits the configs directory to StoreRef when it has changed
+// and returns the commit matching the configs directory
+func (c Ccoco) commitStore() (*object.Commit, error) {
+	repository := c.gitClient.Repository
+
+	files, err := c.readConfigsDirectory()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := c.gitClient.writeTree(files)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := []plumbing.Hash{}
+	ref, err := repository.Reference(StoreRef, true)
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, err
+	}
+	if ref != nil {
+		head, err := repository.CommitObject(ref.Hash())
+		if err != nil {
+			return nil, err
+		}
+		if head.TreeHash == tree {
+			return head, nil
+		}
+		parents = append(parents, head.Hash)
+	}
+
+	hash, err := c.gitClient.writeCommit(tree, parents, "Update ccoco store", c.now())
+	if err != nil {
+		return nil, err
+	}
+	if err := repository.Storer.SetReference(plumbing.NewHashReference(StoreRef, hash)); err != nil {
+		return nil, err
+	}
+	return repository.CommitObject(hash)
+}
+
+// mergeStore merges the store commit theirs into ours and returns the resulting commit
+func (c Ccoco) mergeStore(ours *object.Commit, theirs plumbing.Hash, strategy string) (plumbing.Hash, error) {
+	repository := c.gitClient.Repository
+	if theirs == ours.Hash {
+		return ours.Hash, nil
+	}
+	theirsCommit, err := repository.CommitObject(theirs)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	// Fast-forward when one side already contains the other
+	if isAncestor, err := theirsCommit.IsAncestor(ours); err != nil {
+		return plumbing.ZeroHash, err
+	} else if isAncestor {
+		return ours.Hash, nil
+	}
+	if isAncestor, err := ours.IsAncestor(theirsCommit); err != nil {
+		return plumbing.ZeroHash, err
+	} else if isAncestor {
+		return theirs, nil
+	}
+
+	base := storeFiles{}
+	bases, err := ours.MergeBase(theirsCommit)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if len(bases) > 0 {
+		base, err = c.gitClient.commitFiles(bases[0])
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+	oursFiles, err := c.gitClient.commitFiles(ours)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	theirsFiles, err := c.gitClient.commitFiles(theirsCommit)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	merged, conflicts, err := c.mergeFiles(base, oursFiles, theirsFiles, strategy)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if len(conflicts) > 0 {
+		return plumbing.ZeroHash, &MergeConflictError{Files: conflicts}
+	}
+
+	tree, err := c.gitClient.writeTree(merged)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return c.gitClient.writeCommit(tree, []plumbing.Hash{ours.Hash, theirs}, "Merge ccoco store", c.now())
+}
+
+// mergeFiles merges the files changed on both sides since base. Manifests are
+// merged entry by entry. Files changed differently on both sides are resolved
+// with strategy or returned as conflicts.
+func (c Ccoco) mergeFiles(base, ours, theirs storeFiles, strategy string) (storeFiles, []string, error) {
+	paths := map[string]struct{}{}
+	for _, files := range []storeFiles{base, ours, theirs} {
+		for file := range files {
+			paths[file] = struct{}{}
+		}
+	}
+
+	merged := storeFiles{}
+	conflicts := []string{}
+	for file := range paths {
+		b, inBase := base[file]
+		o, inOurs := ours[file]
+		t, inTheirs := theirs[file]
+
+		var entry storeEntry
+		var exists bool
+		switch {
+		case inOurs == inTheirs && o == t:
+			entry, exists = o, inOurs
+		case inOurs == inBase && o == b:
+			entry, exists = t, inTheirs
+		case inTheirs == inBase && t == b:
+			entry, exists = o, inOurs
+		case path.Base(file) == ManifestFileName && !inFilesDir(file):
+			manifestConflicts := []string{}
+			var err error
+			entry, manifestConflicts, err = c.gitClient.mergeManifests(path.Dir(file), b, o, t, strategy)
+			if err != nil {
+				return nil, nil, err
+			}
+			conflicts = append(conflicts, manifestConflicts...)
+			exists = true
+		case strategy == MergeOurs:
+			entry, exists = o, inOurs
+		case strategy == MergeTheirs:
+			entry, exists = t, inTheirs
+		default:
+			conflicts = append(conflicts, file)
+		}
+		if exists {
+			merged[file] = entry
+		}
+	}
+
+	sort.Strings(conflicts)
+	return merged, compactStrings(conflicts), nil
+}
+
+// mergeManifests merges the entries of three versions of the manifest of branch
+func (g *Git) mergeManifests(branch string, base, ours, theirs storeEntry, strategy string) (storeEntry, []string, error) {
+	manifests := make([]*Manifest, 3)
+	for i, entry := range []storeEntry{base, ours, theirs} {
+		manifest := &Manifest{Files: []ManifestEntry{}}
+		if !entry.Hash.IsZero() {
+			data, err := g.readBlob(entry.Hash)
+			if err != nil {
+				return storeEntry{}, nil, err
+			}
+			if manifest, err = parseManifest(data); err != nil {
+				return storeEntry{}, nil, fmt.Errorf("%w: failed to read manifest of %s: %w", ErrMalformedStore, branch, err)
+			}
+		}
+		manifests[i] = manifest
+	}
+
+	paths := map[string]struct{}{}
+	for _, manifest := range manifests {
+		for _, entry := range manifest.Files {
+			paths[entry.Path] = struct{}{}
+		}
+	}
+
+	// Entries describing the same content are equal regardless of when they were written
+	same := func(a, b ManifestEntry, inA, inB bool) bool {
+		return inA == inB && a.Hash == b.Hash && a.Mode == b.Mode
+	}
+
+	merged := &Manifest{Files: []ManifestEntry{}}
+	conflicts := []string{}
+	for file := range paths {
+		b, inBase := manifests[0].Entry(file)
+		o, inOurs := manifests[1].Entry(file)
+		t, inTheirs := manifests[2].Entry(file)
+
+		var entry ManifestEntry
+		var exists bool
+		switch {
+		case same(o, t, inOurs, inTheirs):
+			entry, exists = o, inOurs
+			if t.UpdatedAt.After(o.UpdatedAt) {
+				entry = t
+			}
+		case same(o, b, inOurs, inBase):
+			entry, exists = t, inTheirs
+		case same(t, b, inTheirs, inBase):
+			entry, exists = o, inOurs
+		case strategy == MergeOurs:
+			entry, exists = o, inOurs
+		case strategy == MergeTheirs:
+			entry, exists = t, inTheirs
+		default:
+			conflicts = append(conflicts, path.Join(branch, file))
+		}
+		if exists {
+			merged.Set(entry)
+		}
+	}
+
+	data, err := marshalManifest(merged)
+	if err != nil {
+		return storeEntry{}, nil, err
+	}
+	hash, err := g.writeBlob(data)
+	if err != nil {
+		return storeEntry{}, nil, err
+	}
+	return storeEntry{Hash: hash, Mode: filemode.Regular}, conflicts, nil
+}
+
+// readConfigsDirectory writes every file of the configs directory as a blob
+func (c Ccoco) readConfigsDirectory() (storeFiles, error) {
+	root := c.configsPath()
+	files := storeFiles{}
+	err := walkDir(c.fs, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := readFile(c.fs, p)
+		if err != nil {
+			return err
+		}
+		hash, err := c.gitClient.writeBlob(data)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		mode := filemode.Regular
+		if info.Mode().Perm()&0111 != 0 {
+			mode = filemode.Executable
+		}
+		files[filepath.ToSlash(rel)] = storeEntry{Hash: hash, Mode: mode}
+		return nil
+	})
+	return files, err
+}
+
+// checkoutStore updates the configs directory from the files of working to the files of target.
+// Stored files get the mode recorded in the manifest of their branch, so pulled secrets stay private.
+func (c Ccoco) checkoutStore(working, target storeFiles) error {
+	root := c.configsPath()
+	modes := map[string]os.FileMode{}
+	for file, entry := range target {
+		// Tree entries are joined to the configs directory, so they must stay inside of it
+		if !isSafeBundlePath(file) {
+			return fmt.Errorf("%w: unsafe path %q in %s", ErrMalformedStore, file, StoreRef)
+		}
+		if path.Base(file) != ManifestFileName || inFilesDir(file) {
+			continue
+		}
+		data, err := c.gitClient.readBlob(entry.Hash)
+		if err != nil {
+			return err
+		}
+		branch := path.Dir(file)
+		manifest, err := parseManifest(data)
+		if err != nil {
+			return fmt.Errorf("%w: failed to read manifest of %s: %w", ErrMalformedStore, branch, err)
+		}
+		for _, stored := range manifest.Files {
+			if mode, err := stored.FileMode(); err == nil {
+				modes[path.Join(branch, StoreFilesDir, stored.Path)] = mode
+			}
+		}
+	}
+
+	for file, entry := range target {
+		mode, recorded := modes[file]
+		if current, exists := working[file]; exists && current == entry {
+			// The content is the same, but the recorded mode may have changed
+			if recorded {
+				if err := chmod(c.fs, filepath.Join(root, filepath.FromSlash(file)), mode); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		data, err := c.gitClient.readBlob(entry.Hash)
+		if err != nil {
+			return err
+		}
+		p := filepath.Join(root, filepath.FromSlash(file))
+		if err := c.fs.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if !recorded {
+			mode = 0644
+			if entry.Mode == filemode.Executable {
+				mode = 0755
+			}
+		}
+		// A synced copy is renamed into place, so a secret is never readable with the previous mode
+		temp, err := writeTemp(c.fs, filepath.Dir(p), filepath.Base(p), data, mode)
+		if err != nil {
+			return err
+		}
+		if err := c.fs.Rename(temp, p); err != nil {
+			_ = c.fs.Remove(temp)
+			return err
+		}
+	}
+	for file := range working {
+		if _, exists := target[file]; exists {
+			continue
+		}
+		if err := c.fs.Remove(filepath.Join(root, filepath.FromSlash(file))); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitFiles returns the files in the tree of commit
+func (g *Git) commitFiles(commit *object.Commit) (storeFiles, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	files := storeFiles{}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files[f.Name] = storeEntry{Hash: f.Hash, Mode: f.Mode}
+		return nil
+	})
+	return files, err
+}
+
+// writeBlob stores data as a blob object
+func (g *Git) writeBlob(data []byte) (plumbing.Hash, error) {
+	obj := g.Repository.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return g.Repository.Storer.SetEncodedObject(obj)
+}
+
+// readBlob returns the content of a blob object
+func (g *Git) readBlob(hash plumbing.Hash) ([]byte, error) {
+	blob, err := g.Repository.BlobObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// writeTree stores files as nested tree objects and returns the hash of the root tree
+func (g *Git) writeTree(files storeFiles) (plumbing.Hash, error) {
+	entries := []object.TreeEntry{}
+	subtrees := map[string]storeFiles{}
+	for file, entry := range files {
+		name, rest, nested := strings.Cut(file, "/")
+		if !nested {
+			entries = append(entries, object.TreeEntry{Name: name, Mode: entry.Mode, Hash: entry.Hash})
+			continue
+		}
+		if subtrees[name] == nil {
+			subtrees[name] = storeFiles{}
+		}
+		subtrees[name][rest] = entry
+	}
+	for name, subtree := range subtrees {
+		hash, err := g.writeTree(subtree)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entries = append(entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: hash})
+	}
+
+	// Git sorts directories as if their name ended with a slash
+	sortName := func(entry object.TreeEntry) string {
+		if entry.Mode == filemode.Dir {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sortName(entries[i]) < sortName(entries[j])
+	})
+
+	obj := g.Repository.Storer.NewEncodedObject()
+	if err := (&object.Tree{Entries: entries}).Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return g.Repository.Storer.SetEncodedObject(obj)
+}
+
+// writeCommit stores a commit of tree authored by the configured git user at when
+func (g *Git) writeCommit(tree plumbing.Hash, parents []plumbing.Hash, message string, when time.Time) (plumbing.Hash, error) {
+	signature := object.Signature{Name: "ccoco", Email: "ccoco@localhost", When: when}
+	if cfg, err := g.Repository.ConfigScoped(config.GlobalScope); err == nil {
+		if cfg.User.Name != "" {
+			signature.Name = cfg.User.Name
+		}
+		if cfg.User.Email != "" {
+			signature.Email = cfg.User.Email
+		}
+	}
+
+	commit := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      message,
+		TreeHash:     tree,
+		ParentHashes: parents,
+	}
+	obj := g.Repository.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return g.Repository.Storer.SetEncodedObject(obj)
+}
+
+// compactStrings removes consecutive duplicates from a sorted slice
+func compactStrings(values []string) []string {
+	out := []string{}
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			out = append(out, value)
+		}
+	}
+	return out
+}
@@ -0,0 +1,253 @@
+package ccoco
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+// manifestContent returns a manifest listing entries with the given hashes by path, as it is stored
+func manifestContent(t *testing.T, hashes map[string]string) string {
+	t.Helper()
+	manifest := &Manifest{Files: []ManifestEntry{}}
+	for file, hash := range hashes {
+		manifest.Set(newManifestEntry(file, hash, 0600, SourceWorkingTree, testNow))
+	}
+	data, err := marshalManifest(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// blobFiles writes the content of every file as a blob
+func blobFiles(t *testing.T, c *Ccoco, contents map[string]string) storeFiles {
+	t.Helper()
+	files := storeFiles{}
+	for file, content := range contents {
+		hash, err := c.gitClient.writeBlob([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file] = storeEntry{Hash: hash, Mode: filemode.Regular}
+	}
+	return files
+}
+
+func TestMergeFiles(t *testing.T) {
+	const (
+		env      = "main/" + StoreFilesDir + "/.env"
+		manifest = "main/" + ManifestFileName
+		// A stored file may be named like a manifest, it is merged like any other file
+		storedManifest = "main/" + StoreFilesDir + "/" + ManifestFileName
+	)
+
+	tests := []struct {
+		name          string
+		base          map[string]string
+		ours          map[string]string
+		theirs        map[string]string
+		strategy      string
+		want          map[string]string
+		wantConflicts []string
+	}{
+		{
+			name:   "unchanged",
+			base:   map[string]string{env: "v1"},
+			ours:   map[string]string{env: "v1"},
+			theirs: map[string]string{env: "v1"},
+			want:   map[string]string{env: "v1"},
+		},
+		{
+			name:   "changed by us",
+			base:   map[string]string{env: "v1"},
+			ours:   map[string]string{env: "v2"},
+			theirs: map[string]string{env: "v1"},
+			want:   map[string]string{env: "v2"},
+		},
+		{
+			name:   "changed by them",
+			base:   map[string]string{env: "v1"},
+			ours:   map[string]string{env: "v1"},
+			theirs: map[string]string{env: "v2"},
+			want:   map[string]string{env: "v2"},
+		},
+		{
+			name:   "added on both sides alike",
+			ours:   map[string]string{env: "v1"},
+			theirs: map[string]string{env: "v1"},
+			want:   map[string]string{env: "v1"},
+		},
+		{
+			name:   "deleted by them",
+			base:   map[string]string{env: "v1"},
+			ours:   map[string]string{env: "v1"},
+			theirs: map[string]string{},
+			want:   map[string]string{},
+		},
+		{
+			name:          "changed on both sides",
+			base:          map[string]string{env: "v1"},
+			ours:          map[string]string{env: "v2"},
+			theirs:        map[string]string{env: "v3"},
+			want:          map[string]string{},
+			wantConflicts: []string{env},
+		},
+		{
+			name:     "changed on both sides with ours",
+			base:     map[string]string{env: "v1"},
+			ours:     map[string]string{env: "v2"},
+			theirs:   map[string]string{env: "v3"},
+			strategy: MergeOurs,
+			want:     map[string]string{env: "v2"},
+		},
+		{
+			name:     "changed by us and deleted by them with theirs",
+			base:     map[string]string{env: "v1"},
+			ours:     map[string]string{env: "v2"},
+			theirs:   map[string]string{},
+			strategy: MergeTheirs,
+			want:     map[string]string{},
+		},
+		{
+			name:   "manifests merged by entry",
+			base:   map[string]string{manifest: manifestContent(t, map[string]string{".env": "h1"})},
+			ours:   map[string]string{manifest: manifestContent(t, map[string]string{".env": "h1", "a": "h2"})},
+			theirs: map[string]string{manifest: manifestContent(t, map[string]string{".env": "h1", "b": "h3"})},
+			want:   map[string]string{manifest: manifestContent(t, map[string]string{".env": "h1", "a": "h2", "b": "h3"})},
+		},
+		{
+			name:   "manifest entry removed by them",
+			base:   map[string]string{manifest: manifestContent(t, map[string]string{".env": "h1", "a": "h2"})},
+			ours:   map[string]string{manifest: manifestContent(t, map[string]string{".env": "h1", "a": "h2", "b": "h3"})},
+			theirs: map[string]string{manifest: manifestContent(t, map[string]string{".env": "h1"})},
+			want:   map[string]string{manifest: manifestContent(t, map[string]string{".env": "h1", "b": "h3"})},
+		},
+		{
+			name:          "manifest entry changed on both sides",
+			base:          map[string]string{manifest: manifestContent(t, map[string]string{".env": "h1", "a": "h2"})},
+			ours:          map[string]string{manifest: manifestContent(t, map[string]string{".env": "h2", "a": "h2"})},
+			theirs:        map[string]string{manifest: manifestContent(t, map[string]string{".env": "h3"})},
+			want:          map[string]string{manifest: manifestContent(t, map[string]string{})},
+			wantConflicts: []string{"main/.env"},
+		},
+		{
+			name:     "manifest entry changed on both sides with theirs",
+			base:     map[string]string{manifest: manifestContent(t, map[string]string{".env": "h1"})},
+			ours:     map[string]string{manifest: manifestContent(t, map[string]string{".env": "h2"})},
+			theirs:   map[string]string{manifest: manifestContent(t, map[string]string{".env": "h3"})},
+			strategy: MergeTheirs,
+			want:     map[string]string{manifest: manifestContent(t, map[string]string{".env": "h3"})},
+		},
+		{
+			name:          "stored file named like a manifest",
+			base:          map[string]string{storedManifest: "v1"},
+			ours:          map[string]string{storedManifest: "v2"},
+			theirs:        map[string]string{storedManifest: "v3"},
+			want:          map[string]string{},
+			wantConflicts: []string{storedManifest},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCcoco(t, &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env"}})
+
+			merged, conflicts, err := c.mergeFiles(blobFiles(t, c, tt.base), blobFiles(t, c, tt.ours), blobFiles(t, c, tt.theirs), tt.strategy)
+			if err != nil {
+				t.Fatalf("mergeFiles() error = %v", err)
+			}
+
+			if !equalStrings(conflicts, tt.wantConflicts) {
+				t.Errorf("conflicts = %v, want %v", conflicts, tt.wantConflicts)
+			}
+			if len(merged) != len(tt.want) {
+				t.Errorf("merged %d files, want %d", len(merged), len(tt.want))
+			}
+			for file, content := range tt.want {
+				entry, ok := merged[file]
+				if !ok {
+					t.Errorf("%s is missing from the merge", file)
+					continue
+				}
+				data, err := c.gitClient.readBlob(entry.Hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != content {
+					t.Errorf("%s = %q, want %q", file, data, content)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckoutStore(t *testing.T) {
+	const (
+		env      = "main/" + StoreFilesDir + "/.env"
+		manifest = "main/" + ManifestFileName
+	)
+	private := &Manifest{Files: []ManifestEntry{newManifestEntry(".env", "h1", 0600, SourceWorkingTree, testNow)}}
+
+	tests := []struct {
+		name      string
+		target    func(t *testing.T) map[string]string
+		wantModes map[string]os.FileMode
+		wantErr   error
+	}{
+		{
+			name: "stored files get their recorded mode",
+			target: func(t *testing.T) map[string]string {
+				data, err := marshalManifest(private)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return map[string]string{env: "secret", manifest: string(data)}
+			},
+			wantModes: map[string]os.FileMode{env: 0600, manifest: 0644},
+		},
+		{
+			name: "unsafe tree path",
+			target: func(t *testing.T) map[string]string {
+				return map[string]string{"main/../../outside": "x"}
+			},
+			wantErr: ErrMalformedStore,
+		},
+		{
+			name: "unsafe manifest path",
+			target: func(t *testing.T) map[string]string {
+				return map[string]string{manifest: manifestContent(t, map[string]string{"certs/../../../outside": "h1"})}
+			},
+			wantErr: ErrMalformedStore,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCcoco(t, &FileContent{StoreFormat: StoreFormatManifest, Files: []string{".env", "certs/"}})
+			// The in-memory filesystem can't change modes
+			c.fs = newOSFilesystem()
+			c.gitClient.RootPathFromCwd = t.TempDir()
+
+			err := c.checkoutStore(storeFiles{}, blobFiles(t, c, tt.target(t)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("checkoutStore() error = %v, want %v", err, tt.wantErr)
+			}
+			for file, mode := range tt.wantModes {
+				info, err := c.fs.Stat(filepath.Join(c.configsPath(), file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != mode {
+					t.Errorf("mode of %s = %s, want %s", file, info.Mode().Perm(), mode)
+				}
+			}
+			if _, err := c.fs.Stat(filepath.Join(c.gitClient.RootPathFromCwd, "outside")); err == nil {
+				t.Error("a file was written outside of the store")
+			}
+		})
+	}
+}
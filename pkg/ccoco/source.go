@@ -0,0 +1,192 @@
+package ccoco
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// StoreSource points the config store outside of the repository, either at a
+// local directory or at a git repository cloned into the user's cache directory
+type StoreSource struct {
+	// Path is a local directory holding the store, relative to the repository root
+	Path string `json:"path,omitempty"`
+	// URL is a git repository holding the store, fetched with ccoco sync
+	URL string `json:"url,omitempty"`
+	// Ref is the branch of URL to check out. Defaults to the remote HEAD.
+	Ref string `json:"ref,omitempty"`
+	// Dir is the directory of Path or URL holding the branch directories
+	Dir string `json:"dir,omitempty"`
+}
+
+func (s *StoreSource) CheckState() error {
+	if (s.Path == "") == (s.URL == "") {
+		return errors.New("exactly one of path and url must be set")
+	}
+	if s.Ref != "" && s.URL == "" {
+		return errors.New("ref requires url")
+	}
+	clean := path.Clean(filepath.ToSlash(s.Dir))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("dir %s is outside of the store", s.Dir)
+	}
+	return nil
+}
+
+// Location describes where the store is kept
+func (s *StoreSource) Location() string {
+	if s.URL != "" {
+		return s.URL
+	}
+	return s.Path
+}
+
+// CachePath returns the directory URL is cloned into
+func (s *StoreSource) CachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(s.URL))
+	return filepath.Join(dir, "ccoco", "stores", hex.EncodeToString(sum[:8])), nil
+}
+
+// locateStore finds the clone of the store repository, so that opening a
+// repository fails rather than reading the store from the wrong place
+func (c *Ccoco) locateStore() error {
+	c.storeCache = ""
+	if c.configFile == nil || c.configFile.Content == nil {
+		return nil
+	}
+	source := c.configFile.Content.Store
+	if source == nil || source.URL == "" {
+		return nil
+	}
+	cachePath, err := source.CachePath()
+	if err != nil {
+		return fmt.Errorf("failed to find the cache directory of the store %s: %w", source.URL, err)
+	}
+	c.storeCache = cachePath
+	return nil
+}
+
+// configsPath returns the directory holding the branch directories
+func (c Ccoco) configsPath() string {
+	source := c.configFile.Content.Store
+	if source == nil {
+		return filepath.Join(c.gitClient.RootPathFromCwd, c.directories.Configs)
+	}
+
+	root := source.Path
+	if source.URL != "" {
+		root = c.storeCache
+	} else if !filepath.IsAbs(root) {
+		root = filepath.Join(c.gitClient.RootPathFromCwd, root)
+	}
+	return filepath.Join(root, filepath.FromSlash(source.Dir))
+}
+
+// checkStoreSynced fails when the store is kept in a git repository that hasn't been synced yet
+func (c Ccoco) checkStoreSynced() error {
+	source := c.configFile.Content.Store
+	if source == nil || source.URL == "" {
+		return nil
+	}
+	cachePath, err := source.CachePath()
+	if err != nil {
+		return err
+	}
+	if _, err := c.fs.Stat(cachePath); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("the store %s is not synced yet, run ccoco sync", source.URL)
+	}
+	return nil
+}
+
+// Sync clones the store repository into the cache directory, or fast-forwards
+// the existing clone to the latest commit of its remote
+func (c Ccoco) Sync(ctx context.Context) error {
+	source := c.configFile.Content.Store
+	if source == nil || source.URL == "" {
+		return fmt.Errorf("no store url in %s, nothing to sync", c.configFile.Name)
+	}
+	if c.dryRun {
+		return ErrDryRun
+	}
+
+	cachePath, err := source.CachePath()
+	if err != nil {
+		return err
+	}
+	reference := plumbing.ReferenceName("")
+	if source.Ref != "" {
+		reference = plumbing.NewBranchReferenceName(source.Ref)
+	}
+
+	// The clone lives on the same filesystem as the store it holds
+	worktreeFS, err := c.fs.Chroot(cachePath)
+	if err != nil {
+		return err
+	}
+	dotGit, err := worktreeFS.Chroot(git.GitDirName)
+	if err != nil {
+		return err
+	}
+	storage := filesystem.NewStorage(dotGit, cache.NewObjectLRUDefault())
+
+	repository, err := git.Open(storage, worktreeFS)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		if _, err := git.CloneContext(ctx, storage, worktreeFS, &git.CloneOptions{
+			URL:           source.URL,
+			ReferenceName: reference,
+			SingleBranch:  true,
+		}); err != nil {
+			_ = removeAll(c.fs, cachePath)
+			return fmt.Errorf("failed to clone %s: %w", source.URL, err)
+		}
+		c.logger.Info("Cloned store", "url", source.URL, "path", cachePath)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return err
+	}
+	// Saved or generated configs would be lost, they have to be committed in the clone first
+	status, err := worktree.Status()
+	if err != nil {
+		return err
+	}
+	if !status.IsClean() {
+		return fmt.Errorf("%w: %s has local changes, commit and push them before syncing", ErrDirtyFile, cachePath)
+	}
+
+	err = worktree.PullContext(ctx, &git.PullOptions{
+		RemoteName:    git.DefaultRemoteName,
+		ReferenceName: reference,
+		SingleBranch:  true,
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		c.logger.Info("Store is up to date", "url", source.URL)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to sync %s: %w", source.URL, err)
+	}
+
+	c.logger.Info("Synced store", "url", source.URL)
+	return nil
+}
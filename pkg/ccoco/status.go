@@ -0,0 +1,127 @@
+package ccoco
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+)
+
+// Actions taken on a managed file when a config set is applied
+const (
+	ActionApply   = "apply"
+	ActionKeep    = "keep"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionFail    = "fail"
+	ActionSkip    = "skip"
+)
+
+type (
+	Status struct {
+		// Branch is the checked out branch
+		Branch string `json:"branch"`
+		// ConfigBranch is the branch directory the configs are applied from
+		ConfigBranch string       `json:"configBranch"`
+		Files        []FileStatus `json:"files"`
+	}
+	FileStatus struct {
+		File string `json:"file"`
+		// Stored reports whether the config branch has a stored copy of the file
+		Stored bool `json:"stored"`
+		// Tracked reports whether the file is tracked by git
+		Tracked bool `json:"tracked"`
+		// OnMissing is the policy used when the file has no stored copy
+		OnMissing string `json:"onMissing,omitempty"`
+		// Action is what ccoco run does with the file
+		Action string `json:"action"`
+		Reason string `json:"reason,omitempty"`
+		// Warning explains how a tracked file could be committed with branch-specific
+		// content or block git checkout
+		Warning string `json:"warning,omitempty"`
+	}
+)
+
+// Status reports what ccoco run would do with every managed file on the current branch
+func (c Ccoco) Status(ctx context.Context) (*Status, error) {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return nil, ErrNotInitialized
+	}
+
+	branch, err := c.gitClient.CurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+
+	configBranch, err := c.resolveConfigBranch(branch)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := c.openStore(configBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	files, _, err := c.planApply(store)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	entries, err := c.gitClient.IndexEntries()
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		if !files[i].Tracked {
+			continue
+		}
+		files[i].Warning, err = c.trackedWarning(files[i].File, entries[files[i].File])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Status{
+		Branch:       branch,
+		ConfigBranch: configBranch,
+		Files:        files,
+	}, nil
+}
+
+// trackedWarning explains how a tracked managed file could end up committed
+// with branch-specific content, or get in the way of switching branches. It
+// returns an empty string when it can't.
+func (c Ccoco) trackedWarning(file string, entry *index.Entry) (string, error) {
+	headHash, tracked, err := c.gitClient.HeadFileHash(file)
+	if err != nil {
+		return "", err
+	}
+	if tracked && entry.Hash != headHash {
+		return "staged content differs from HEAD and will be committed", nil
+	}
+
+	data, err := readFile(c.fs, filepath.Join(c.gitClient.RootPathFromCwd, file))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	changed := err != nil || plumbing.ComputeHash(plumbing.BlobObject, data) != entry.Hash
+
+	if !entry.SkipWorktree && changed {
+		return "changed in the working tree without skip-worktree and may be committed, run ccoco run", nil
+	}
+	// git refuses to overwrite hidden changes, so there is no hook to clear the bit in time
+	if entry.SkipWorktree && changed {
+		return fmt.Sprintf("git checkout aborts on branches changing it, run git update-index --no-skip-worktree %[1]s && git restore %[1]s first", file), nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,65 @@
+package ccoco
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestTrackedWarning(t *testing.T) {
+	tests := []struct {
+		name string
+		// content is the working tree content of the committed file
+		content string
+		skip    bool
+		// want is a part of the warning, an empty string expects none
+		want string
+	}{
+		{name: "committed content", content: "committed"},
+		{name: "changed without skip-worktree", content: "applied", want: "may be committed"},
+		{name: "hidden with skip-worktree", content: "applied", skip: true, want: "git checkout aborts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCcoco(t, &FileContent{StoreFormat: StoreFormatManifest, Files: []string{"config.json"}})
+			worktree, err := c.gitClient.Repository.Worktree()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writeFile(c.fs, "config.json", []byte("committed"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := worktree.Add("config.json"); err != nil {
+				t.Fatal(err)
+			}
+			signature := &object.Signature{Name: "test", Email: "test@example.com", When: testNow}
+			if _, err := worktree.Commit("initial", &git.CommitOptions{Author: signature}); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeFile(c.fs, "config.json", []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.skip {
+				if err := c.gitClient.SetSkipWorktree(context.Background(), []string{"config.json"}, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			entries, err := c.gitClient.IndexEntries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.trackedWarning("config.json", entries["config.json"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("trackedWarning() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,640 @@
+package ccoco
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/go-git/go-billy/v5"
+)
+
+// Store formats of the per-branch config directories.
+const (
+	// StoreFormatFlat flattens nested files to basename-<base58(dir)>.
+	StoreFormatFlat = 1
+	// StoreFormatMirrored mirrors the working tree layout inside each branch directory.
+	StoreFormatMirrored = 2
+	// StoreFormatManifest stores files as-is and keeps their metadata in a per-branch manifest.
+	StoreFormatManifest = 3
+
+	LatestStoreFormat = StoreFormatManifest
+)
+
+// StoreFilesDir is the directory of a branch directory holding its stored files.
+// Branch names can't have a component starting with a dot, so stored files
+// never share a path with the directory of a sub-branch.
+const StoreFilesDir = ".ccoco-files"
+
+var headerPattern = regexp.MustCompile(`^CCOCO GENERATED FILE - (.+) - DO NOT REMOVE OR EDIT THIS LINE\r?$`)
+
+// header returns the first line ccoco writes to every stored file
+func header(file string) string {
+	return "CCOCO GENERATED FILE - " + file + " - DO NOT REMOVE OR EDIT THIS LINE"
+}
+
+// storeName returns the path of file inside a branch directory for the given store format
+func storeName(format int, file string) string {
+	if format == StoreFormatFlat {
+		if strings.Contains(file, "/") {
+			return filepath.Base(file) + "-" + base58.Encode([]byte(filepath.Dir(file)))
+		}
+		return file
+	}
+	return filepath.Join(StoreFilesDir, filepath.FromSlash(path.Clean(filepath.ToSlash(file))))
+}
+
+// inFilesDir reports whether rel, a slash-separated path relative to the configs
+// directory, lies inside the files directory of a branch
+func inFilesDir(rel string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if part == StoreFilesDir {
+			return true
+		}
+	}
+	return false
+}
+
+// stripHeader removes the header of file from data. It reports false when
+// data does not start with the header.
+func stripHeader(file string, data []byte) ([]byte, bool) {
+	line, rest, found := bytes.Cut(data, []byte("\n"))
+	if string(bytes.TrimSuffix(line, []byte("\r"))) != header(file) {
+		return data, false
+	}
+	if !found {
+		return []byte{}, true
+	}
+	return rest, true
+}
+
+// branchPath returns the directory holding the stored files of branch
+func (c Ccoco) branchPath(branch string) string {
+	return filepath.Join(c.configsPath(), branch)
+}
+
+// storePath returns the path of the stored copy of file for branch
+func (c Ccoco) storePath(branch, file string) string {
+	return filepath.Join(c.branchPath(branch), storeName(c.configFile.Content.Format(), file))
+}
+
+// branchStore reads and writes the stored files of a single branch
+type branchStore struct {
+	c        Ccoco
+	branch   string
+	manifest *Manifest
+	dirty    bool
+	// key is loaded on first use of an encrypted file
+	key []byte
+}
+
+// openStore opens the store of branch, loading its manifest when the store format has one
+func (c Ccoco) openStore(branch string) (*branchStore, error) {
+	s := &branchStore{c: c, branch: branch, manifest: &Manifest{Files: []ManifestEntry{}}}
+	if c.configFile.Content.Format() >= StoreFormatManifest {
+		manifest, err := readManifest(c.fs, filepath.Join(c.branchPath(branch), ManifestFileName))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read manifest of %s: %w", ErrMalformedStore, branch, err)
+		}
+		s.manifest = manifest
+	}
+	return s, nil
+}
+
+// Exists reports whether file has a stored copy
+func (s *branchStore) Exists(file string) bool {
+	_, err := s.c.fs.Stat(s.c.storePath(s.branch, file))
+	return err == nil
+}
+
+// Read returns the stored content of file without any ccoco metadata
+func (s *branchStore) Read(file string) ([]byte, error) {
+	data, err := readFile(s.c.fs, s.c.storePath(s.branch, file))
+	if err != nil {
+		return nil, err
+	}
+
+	if isEncrypted(data) {
+		key, err := s.loadKey()
+		if err != nil {
+			return nil, err
+		}
+		data, err = decrypt(key, data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decrypt %s: %w", ErrMalformedStore, file, err)
+		}
+		return data, nil
+	}
+
+	data, ok := stripHeader(file, data)
+	if !ok && s.c.configFile.Content.Format() < StoreFormatManifest {
+		return nil, fmt.Errorf("%w: malformed config file %s", ErrMalformedStore, file)
+	}
+	return data, nil
+}
+
+// loadKey returns the encryption key, loading it on first use
+func (s *branchStore) loadKey() ([]byte, error) {
+	if s.key == nil {
+		key, err := LoadKey()
+		if err != nil {
+			return nil, err
+		}
+		s.key = key
+	}
+	return s.key, nil
+}
+
+// Match returns the stored files belonging to entry
+func (s *branchStore) Match(entry string) []string {
+	files := []string{}
+	for _, e := range s.manifest.Files {
+		if matchEntry(entry, e.Path) {
+			files = append(files, e.Path)
+		}
+	}
+	return files
+}
+
+// Delete removes the stored copy of file
+func (s *branchStore) Delete(file string) error {
+	if err := s.c.fs.Remove(s.c.storePath(s.branch, file)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	s.manifest.Remove(file)
+	s.dirty = true
+	return nil
+}
+
+// Mode returns the mode recorded for file. It reports false when the store has no mode for it.
+func (s *branchStore) Mode(file string) (os.FileMode, bool) {
+	entry, ok := s.manifest.Entry(file)
+	if !ok {
+		// Stores without a manifest keep the mode on the stored file itself
+		if s.c.configFile.Content.Format() < StoreFormatManifest {
+			if info, err := s.c.fs.Stat(s.c.storePath(s.branch, file)); err == nil {
+				return info.Mode().Perm(), true
+			}
+		}
+		return 0, false
+	}
+	mode, err := entry.FileMode()
+	if err != nil {
+		s.c.logger.Warn("Invalid mode recorded", "file", file, "mode", entry.Mode)
+		return 0, false
+	}
+	return mode, true
+}
+
+// Write stores data for file and records it in the manifest
+func (s *branchStore) Write(file string, data []byte, mode os.FileMode, source string) error {
+	path := s.c.storePath(s.branch, file)
+	if err := s.c.fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if s.c.configFile.Content.Format() < StoreFormatManifest {
+		data = append([]byte(header(file)+"\n"), data...)
+	} else {
+		hash, err := s.hash(data)
+		if err != nil {
+			return err
+		}
+		s.manifest.Set(newManifestEntry(file, hash, mode, source, s.c.now()))
+		s.dirty = true
+	}
+
+	return s.writeData(file, data, mode)
+}
+
+// hash returns the manifest hash of data, keyed by the store key when the store is encrypted
+func (s *branchStore) hash(data []byte) (string, error) {
+	if !s.c.configFile.Content.Encrypt {
+		return hashData(data), nil
+	}
+	key, err := s.loadKey()
+	if err != nil {
+		return "", err
+	}
+	return macData(key, data), nil
+}
+
+// writeData writes data to the stored copy of file, encrypting it when the store is encrypted
+func (s *branchStore) writeData(file string, data []byte, mode os.FileMode) error {
+	path := s.c.storePath(s.branch, file)
+	if s.c.configFile.Content.Encrypt {
+		key, err := s.loadKey()
+		if err != nil {
+			return err
+		}
+		data, err = encrypt(key, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Rename a synced copy over the stored file, so it is never left half written
+	// and a read-only mode from an earlier save doesn't get in the way
+	temp, err := writeTemp(s.c.fs, filepath.Dir(path), filepath.Base(path), data, mode)
+	if err != nil {
+		return err
+	}
+	if err := s.c.fs.Rename(temp, path); err != nil {
+		_ = s.c.fs.Remove(temp)
+		return err
+	}
+	return nil
+}
+
+// ReadStored returns the content of file stored for branch, decrypted when needed
+func (c Ccoco) ReadStored(branch, file string) ([]byte, error) {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return nil, ErrNotInitialized
+	}
+
+	store, err := c.openStore(branch)
+	if err != nil {
+		return nil, err
+	}
+	return store.Read(filepath.ToSlash(file))
+}
+
+// WriteStored replaces the content of file stored for branch, encrypting it when needed
+func (c Ccoco) WriteStored(branch, file string, data []byte) error {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return ErrNotInitialized
+	}
+
+	file = filepath.ToSlash(file)
+	if !c.isManaged(file) {
+		return fmt.Errorf("%s is not in %s", file, c.configFile.Name)
+	}
+
+	store, err := c.openStore(branch)
+	if err != nil {
+		return err
+	}
+	mode, ok := store.Mode(file)
+	if !ok {
+		mode = 0644
+	}
+	if err := store.Write(file, data, mode, SourceEdit); err != nil {
+		return err
+	}
+	return store.Close()
+}
+
+// Close writes the manifest when it has changed
+func (s *branchStore) Close() error {
+	// Stores without a manifest never write one
+	if !s.dirty || s.c.configFile.Content.Format() < StoreFormatManifest {
+		return nil
+	}
+	s.dirty = false
+	return writeManifest(s.c.fs, filepath.Join(s.c.branchPath(s.branch), ManifestFileName), s.manifest)
+}
+
+// storedFile is a file stored for a branch
+type storedFile struct {
+	Branch string
+	File   string
+}
+
+// listStoredFiles returns every file stored for every branch, sorted by branch and file
+func (c Ccoco) listStoredFiles() ([]storedFile, error) {
+	configsPath := c.configsPath()
+	format := c.configFile.Content.Format()
+
+	files := []storedFile{}
+	err := walkDir(c.fs, configsPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		// Manifests list the files of their branch directory, stored files never name a branch
+		if format >= StoreFormatManifest && d.IsDir() && d.Name() == StoreFilesDir {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		if format >= StoreFormatManifest {
+			if d.Name() != ManifestFileName {
+				return nil
+			}
+			branch, err := filepath.Rel(configsPath, filepath.Dir(path))
+			if err != nil {
+				return err
+			}
+			manifest, err := readManifest(c.fs, path)
+			if err != nil {
+				return fmt.Errorf("%w: failed to read manifest of %s: %w", ErrMalformedStore, branch, err)
+			}
+			for _, entry := range manifest.Files {
+				files = append(files, storedFile{Branch: filepath.ToSlash(branch), File: entry.Path})
+			}
+			return nil
+		}
+
+		// Older formats name their target in the header of each file
+		file, ok, err := readHeader(c.fs, path)
+		if err != nil || !ok {
+			return err
+		}
+		branchDir := strings.TrimSuffix(path, string(filepath.Separator)+storeName(format, file))
+		if branchDir == path {
+			c.logger.Warn("Skipping file stored outside of its path", "path", path, "file", file)
+			return nil
+		}
+		branch, err := filepath.Rel(configsPath, branchDir)
+		if err != nil {
+			return err
+		}
+		files = append(files, storedFile{Branch: filepath.ToSlash(branch), File: file})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Branch != files[j].Branch {
+			return files[i].Branch < files[j].Branch
+		}
+		return files[i].File < files[j].File
+	})
+	return files, nil
+}
+
+// writeConfigFile writes the current config file content to disk
+func (c Ccoco) writeConfigFile() error {
+	// Never write a config file the next command couldn't load
+	if err := c.configFile.CheckState(); err != nil {
+		return fmt.Errorf("refusing to write an invalid %s: %w", c.configFile.Name, err)
+	}
+	configData, err := json.MarshalIndent(c.configFile.Content, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := removeAll(c.fs, filepath.Join(c.gitClient.RootPathFromCwd, c.configFile.Name)); err != nil {
+		return err
+	}
+
+	if err := writeFile(c.fs, filepath.Join(c.gitClient.RootPathFromCwd, c.configFile.Name), configData, 0644); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Migrate converts the config store to the latest store format, one format at a time
+func (c Ccoco) Migrate(ctx context.Context) error {
+	// Check if configs are initialized
+	if !c.IsInitialized() {
+		return ErrNotInitialized
+	}
+
+	migrations := map[int]func() error{
+		StoreFormatFlat:     c.migrateFlatToMirrored,
+		StoreFormatMirrored: c.migrateHeaderToManifest,
+	}
+
+	format := c.configFile.Content.Format()
+	if format == LatestStoreFormat {
+		c.logger.Info("Config store is already at the latest format", "format", format)
+		return nil
+	}
+
+	for ; format < LatestStoreFormat; format++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := migrations[format](); err != nil {
+			return fmt.Errorf("failed to migrate store format %d: %w", format, err)
+		}
+		c.configFile.Content.StoreFormat = format + 1
+		if err := c.writeConfigFile(); err != nil {
+			return err
+		}
+		c.logger.Info("Migrated config store", "format", format+1)
+	}
+
+	return nil
+}
+
+// migrateFlatToMirrored moves every flattened file to its mirrored path.
+// The target path is taken from the header of each stored file, so the
+// base58 suffix never has to be decoded.
+func (c Ccoco) migrateFlatToMirrored() error {
+	configsPath := c.configsPath()
+
+	moves := map[string]string{}
+	if err := walkDir(c.fs, configsPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		file, ok, err := readHeader(c.fs, path)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			c.logger.Warn("Skipping file without ccoco header", "path", path)
+			return nil
+		}
+
+		destination := filepath.Join(filepath.Dir(path), storeName(StoreFormatMirrored, file))
+		if destination != path {
+			moves[path] = destination
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Check for collisions before touching anything
+	destinations := map[string]string{}
+	for source, destination := range moves {
+		if other, exists := destinations[destination]; exists {
+			return fmt.Errorf("%s and %s both map to %s", source, other, destination)
+		}
+		if _, err := c.fs.Lstat(destination); err == nil {
+			return fmt.Errorf("cannot move %s: %s already exists", source, destination)
+		}
+		destinations[destination] = source
+	}
+
+	for source, destination := range moves {
+		if err := c.fs.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+			return err
+		}
+		if err := c.fs.Rename(source, destination); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrationStagingSuffix names the directory next to the configs directory
+// a migration builds the new store in before swapping it into place
+const migrationStagingSuffix = ".migrate"
+
+// migrateHeaderToManifest strips the header of every stored file and records
+// the file in the manifest of its branch directory instead. The new files and
+// manifests are built in a staging directory and swapped in manifests first,
+// so an interrupted migration can be run again: a file without a header that
+// is listed in the manifest of its branch has already been migrated.
+func (c Ccoco) migrateHeaderToManifest() error {
+	configsPath := c.configsPath()
+	stagingPath := configsPath + migrationStagingSuffix
+	if err := removeAll(c.fs, stagingPath); err != nil {
+		return err
+	}
+
+	manifests := map[string]*Manifest{}
+	openManifest := func(branch string) (*Manifest, error) {
+		if manifest, ok := manifests[branch]; ok {
+			return manifest, nil
+		}
+		manifest, err := readManifest(c.fs, filepath.Join(configsPath, branch, ManifestFileName))
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read manifest of %s: %w", ErrMalformedStore, branch, err)
+		}
+		manifests[branch] = manifest
+		return manifest, nil
+	}
+
+	staged := []string{}
+	if err := walkDir(c.fs, configsPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(configsPath, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.Name() == ManifestFileName && !inFilesDir(rel) {
+			return nil
+		}
+
+		file, ok, err := readHeader(c.fs, path)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if branch, file, found := strings.Cut(rel, "/"+StoreFilesDir+"/"); found {
+				manifest, err := openManifest(branch)
+				if err != nil {
+					return err
+				}
+				if _, listed := manifest.Entry(file); listed {
+					return nil
+				}
+			}
+			c.logger.Warn("Skipping file without ccoco header", "path", path)
+			return nil
+		}
+
+		// The branch directory is whatever is left after removing the mirrored file path
+		name := filepath.ToSlash(storeName(StoreFormatMirrored, file))
+		branch := strings.TrimSuffix(rel, "/"+name)
+		if branch == rel {
+			return fmt.Errorf("%w: stored file %s does not match its header %s", ErrMalformedStore, path, file)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := readFile(c.fs, path)
+		if err != nil {
+			return err
+		}
+		data, _ = stripHeader(file, data)
+
+		stagedPath := filepath.Join(stagingPath, filepath.FromSlash(rel))
+		if err := c.fs.MkdirAll(filepath.Dir(stagedPath), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(c.fs, stagedPath, data, info.Mode().Perm()); err != nil {
+			return err
+		}
+		staged = append(staged, rel)
+
+		manifest, err := openManifest(branch)
+		if err != nil {
+			return err
+		}
+		// Stores are only encrypted from the manifest format on
+		entry := newManifestEntry(file, hashData(data), info.Mode(), SourceMigration, c.now())
+		entry.UpdatedAt = info.ModTime().UTC()
+		manifest.Set(entry)
+		return nil
+	}); err != nil {
+		removeAll(c.fs, stagingPath)
+		return err
+	}
+
+	for branch, manifest := range manifests {
+		staged = append([]string{path.Join(branch, ManifestFileName)}, staged...)
+		if err := writeManifest(c.fs, filepath.Join(stagingPath, branch, ManifestFileName), manifest); err != nil {
+			removeAll(c.fs, stagingPath)
+			return err
+		}
+	}
+
+	// Manifests go first, older formats ignore them until every file is swapped in
+	for _, rel := range staged {
+		if err := c.fs.Rename(filepath.Join(stagingPath, filepath.FromSlash(rel)), filepath.Join(configsPath, filepath.FromSlash(rel))); err != nil {
+			return err
+		}
+	}
+
+	return removeAll(c.fs, stagingPath)
+}
+
+// readHeader returns the target file recorded in the first line of a stored file
+func readHeader(fsys billy.Filesystem, path string) (string, bool, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return "", false, nil
+	}
+	match := headerPattern.FindStringSubmatch(strings.TrimSuffix(line, "\n"))
+	if match == nil {
+		return "", false, nil
+	}
+	return match[1], true, nil
+}
@@ -0,0 +1,106 @@
+package ccoco
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateHeaderToManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		branches map[string][]string
+		// prepare changes the store before the migration, e.g. to leave it half migrated
+		prepare func(t *testing.T, c *Ccoco)
+		want    map[string][]string
+		// untouched are files the migration must leave as they are
+		untouched map[string]string
+	}{
+		{
+			name:     "strips headers into manifests",
+			branches: map[string][]string{"main": {".env", "certs/dev.pem"}, "feature/x": {".env"}},
+			want:     map[string][]string{"main": {".env", "certs/dev.pem"}, "feature/x": {".env"}},
+		},
+		{
+			name:     "resumes an interrupted migration",
+			branches: map[string][]string{"main": {".env", "certs/dev.pem"}, "feature/x": {".env"}},
+			prepare: func(t *testing.T, c *Ccoco) {
+				// The manifest of main and its .env were swapped in before the interruption
+				if err := writeFile(c.fs, c.storePath("main", ".env"), []byte(".env"), 0600); err != nil {
+					t.Fatal(err)
+				}
+				manifest := &Manifest{Files: []ManifestEntry{
+					newManifestEntry(".env", hashData([]byte(".env")), 0600, SourceMigration, testNow),
+					newManifestEntry("certs/dev.pem", hashData([]byte("certs/dev.pem")), 0600, SourceMigration, testNow),
+				}}
+				if err := writeManifest(c.fs, filepath.Join(c.branchPath("main"), ManifestFileName), manifest); err != nil {
+					t.Fatal(err)
+				}
+				leftover := filepath.Join(c.configsPath()+migrationStagingSuffix, "main", StoreFilesDir, "certs", "dev.pem")
+				if err := c.fs.MkdirAll(filepath.Dir(leftover), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := writeFile(c.fs, leftover, []byte("half written"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: map[string][]string{"main": {".env", "certs/dev.pem"}, "feature/x": {".env"}},
+		},
+		{
+			name:     "skips files without a header",
+			branches: map[string][]string{"main": {".env"}},
+			prepare: func(t *testing.T, c *Ccoco) {
+				if err := writeFile(c.fs, filepath.Join(c.branchPath("main"), StoreFilesDir, "notes.txt"), []byte("notes"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want:      map[string][]string{"main": {".env"}},
+			untouched: map[string]string{"main/" + StoreFilesDir + "/notes.txt": "notes"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCcoco(t, &FileContent{StoreFormat: StoreFormatMirrored, Files: []string{".env", "certs"}})
+			storeTestFiles(t, c, tt.branches)
+			if tt.prepare != nil {
+				tt.prepare(t, c)
+			}
+
+			if err := c.migrateHeaderToManifest(); err != nil {
+				t.Fatalf("migrateHeaderToManifest() error = %v", err)
+			}
+
+			if _, err := c.fs.Stat(c.configsPath() + migrationStagingSuffix); err == nil {
+				t.Error("staging directory was not removed")
+			}
+			c.configFile.Content.StoreFormat = StoreFormatManifest
+			for branch, files := range tt.want {
+				store, err := c.openStore(branch)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(store.manifest.Files) != len(files) {
+					t.Errorf("manifest of %s = %v, want %v", branch, store.manifest.Files, files)
+				}
+				for _, file := range files {
+					if got := string(readTestFile(t, c.fs, c.storePath(branch, file))); got != file {
+						t.Errorf("%s of %s = %q, want %q", file, branch, got, file)
+					}
+					entry, ok := store.manifest.Entry(file)
+					if !ok {
+						t.Errorf("%s of %s is not in the manifest", file, branch)
+						continue
+					}
+					if entry.Hash != hashData([]byte(file)) || entry.Mode != "0600" || entry.Source != SourceMigration {
+						t.Errorf("entry of %s of %s = %+v", file, branch, entry)
+					}
+				}
+			}
+			for rel, content := range tt.untouched {
+				if got := string(readTestFile(t, c.fs, filepath.Join(c.configsPath(), rel))); got != content {
+					t.Errorf("%s = %q, want %q", rel, got, content)
+				}
+			}
+		})
+	}
+}